@@ -0,0 +1,145 @@
+// Package main @author: Violet-Eva @date  : 2026/10/18 @notes :
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/violet-eva-01/fileManager/fm"
+)
+
+// 读取 FM_ 前缀的环境变量
+func loadEnv(cfg *fm.Config) error {
+	setString := func(name string, target *string) {
+		if value, ok := os.LookupEnv(name); ok {
+			*target = value
+		}
+	}
+	setString("FM_ROOT_DIR", &cfg.RootDir)
+	setString("FM_SYMLINK_POLICY", &cfg.SymlinkPolicy)
+	setString("FM_HOME_DIR", &cfg.HomeDir)
+	setString("FM_MAINTENANCE_MESSAGE", &cfg.MaintenanceMessage)
+	setString("FM_USERS_FILE", &cfg.UsersFile)
+	setString("FM_USER_STORE", &cfg.UserStore.Type)
+	setString("FM_USER_STORE_PATH", &cfg.UserStore.Path)
+	setString("FM_JWT_KEY_DIR", &cfg.JWT.KeyDir)
+	setString("FM_GIN_MODE", &cfg.GinMode)
+	setString("FM_THEME", &cfg.Theme)
+	setString("FM_DEFAULT_LOCALE", &cfg.DefaultLocale)
+	setString("FM_LOG_LEVEL", &cfg.Log.Level)
+	setString("FM_LOG_FORMAT", &cfg.Log.Format)
+	setString("FM_LOG_FILE", &cfg.Log.File)
+
+	if value, ok := os.LookupEnv("FM_PORT"); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("FM_PORT 不是合法的整数: %v", err)
+		}
+		cfg.Port = port
+	}
+	if value, ok := os.LookupEnv("FM_MAX_UPLOAD_SIZE"); ok {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("FM_MAX_UPLOAD_SIZE 不是合法的整数: %v", err)
+		}
+		cfg.MaxUploadSize = size
+	}
+	for name, target := range map[string]*bool{"FM_READ_ONLY": &cfg.ReadOnly, "FM_MAINTENANCE": &cfg.Maintenance} {
+		if value, ok := os.LookupEnv(name); ok {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s 不是合法的布尔值: %v", name, err)
+			}
+			*target = enabled
+		}
+	}
+	if value, ok := os.LookupEnv("FM_GUEST_PERMISSIONS"); ok {
+		cfg.Guest.Permissions = splitList(value)
+	}
+	if value, ok := os.LookupEnv("FM_TRUSTED_PROXIES"); ok {
+		cfg.TrustedProxies = splitList(value)
+	}
+	if value, ok := os.LookupEnv("FM_MOUNTS"); ok {
+		for _, spec := range strings.Split(value, ";") {
+			if strings.TrimSpace(spec) == "" {
+				continue
+			}
+			if err := addMountSpec(cfg, spec); err != nil {
+				return fmt.Errorf("FM_MOUNTS: %v", err)
+			}
+		}
+	}
+	if value, ok := os.LookupEnv("FM_USERS"); ok {
+		for _, spec := range strings.Split(value, ";") {
+			if strings.TrimSpace(spec) == "" {
+				continue
+			}
+			if err := addUserSpec(cfg, spec); err != nil {
+				return fmt.Errorf("FM_USERS: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// 解析用户描述 用户名:密码哈希[:角色[:权限1,权限2]]，未指定路径限制时可访问整个目录
+func addUserSpec(cfg *fm.Config, spec string) error {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 4)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("用户格式应为 用户名:密码哈希[:角色[:权限1,权限2]]: %q", spec)
+	}
+
+	user := fm.UserConfig{
+		PasswordHash:     parts[1],
+		PathRestrictions: []string{"/"},
+	}
+	if len(parts) > 2 {
+		user.Role = parts[2]
+	}
+	if len(parts) > 3 {
+		user.Permissions = splitList(parts[3])
+	}
+	if cfg.Users == nil {
+		cfg.Users = map[string]fm.UserConfig{}
+	}
+	cfg.Users[parts[0]] = user
+	return nil
+}
+
+// 解析挂载点描述 名称=目录[,ro]
+func addMountSpec(cfg *fm.Config, spec string) error {
+	name, value, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	options := strings.Split(value, ",")
+	if !ok || name == "" || options[0] == "" {
+		return fmt.Errorf("挂载点格式应为 名称=目录[,ro]: %q", spec)
+	}
+
+	mount := fm.MountConfig{Dir: options[0]}
+	for _, option := range options[1:] {
+		switch strings.TrimSpace(option) {
+		case "ro":
+			mount.ReadOnly = true
+		case "rw", "":
+		default:
+			return fmt.Errorf("未知的挂载选项 %q: %q", option, spec)
+		}
+	}
+	if cfg.Mounts == nil {
+		cfg.Mounts = map[string]fm.MountConfig{}
+	}
+	cfg.Mounts[name] = mount
+	return nil
+}
+
+// 拆分逗号分隔的列表
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
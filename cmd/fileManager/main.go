@@ -0,0 +1,244 @@
+// Package main @author: Violet-Eva @date  : 2026/10/18 @notes : 独立运行的文件管理器
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/violet-eva-01/fileManager/fm"
+)
+
+// 运行模式
+const (
+	modeRun          = "run"
+	modePrintConfig  = "print-config"
+	modeHashPassword = "hash-password"
+	modeGenerateKey  = "generate-jwt-key"
+)
+
+// userFlags 可重复的 -user、-mount 参数
+type userFlags []string
+
+func (u *userFlags) String() string {
+	return strings.Join(*u, ";")
+}
+
+func (u *userFlags) Set(value string) error {
+	*u = append(*u, value)
+	return nil
+}
+
+func main() {
+	cfg, mode, err := loadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if mode == modeHashPassword {
+		if err = hashPassword(os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if mode == modeGenerateKey {
+		if cfg.JWT.KeyDir == "" {
+			fmt.Fprintln(os.Stderr, "-generate-jwt-key 需要通过 -jwt-key-dir 或配置文件的 jwt.key_dir 指定密钥目录")
+			os.Exit(2)
+		}
+		path, err := fm.GenerateJWTKey(cfg.JWT.KeyDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(path)
+		return
+	}
+
+	if mode == modePrintConfig {
+		// 密码哈希、密钥等敏感字段替换为占位符，避免出现在 CI 日志中
+		data, err := yaml.Marshal(cfg.Redacted())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Print(string(data))
+		return
+	}
+
+	manager, err := fm.NewFromConfig(cfg, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "配置无效:\n%v\n", err)
+		os.Exit(1)
+	}
+	if err = manager.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// 合并默认值、配置文件、环境变量和命令行参数，优先级: 命令行参数 > 环境变量 > 配置文件 > 默认值
+func loadConfig(args []string) (*fm.Config, string, error) {
+	var (
+		configPath     string
+		printConfig    bool
+		hashPassword   bool
+		generateKey    bool
+		rootDir        string
+		port           int
+		ginMode        string
+		maxUploadSize  int64
+		theme          string
+		defaultLocale  string
+		logLevel       string
+		logFormat      string
+		logFile        string
+		guestPerms     string
+		usersFile      string
+		userStore      string
+		userStorePath  string
+		jwtKeyDir      string
+		proxies        string
+		symlinkPolicy  string
+		homeDir        string
+		readOnly       bool
+		maintenance    bool
+		maintenanceMsg string
+		users          userFlags
+		mounts         userFlags
+	)
+
+	flags := flag.NewFlagSet("fileManager", flag.ContinueOnError)
+	flags.StringVar(&configPath, "config", os.Getenv("FM_CONFIG"), "配置文件路径，支持 .yaml/.yml/.toml/.json (环境变量 FM_CONFIG)")
+	flags.BoolVar(&printConfig, "print-config", false, "输出合并后的最终配置并退出")
+	flags.BoolVar(&hashPassword, "hash-password", false, "从标准输入读取密码，输出 argon2id 哈希并退出")
+	flags.BoolVar(&generateKey, "generate-jwt-key", false, "在 JWT 密钥目录中生成新的签名私钥并退出，运行中的实例收到 SIGHUP 后开始使用新密钥")
+	flags.StringVar(&rootDir, "root", "", "文件管理的根目录 (FM_ROOT_DIR)")
+	flags.IntVar(&port, "port", 0, "监听端口 (FM_PORT)")
+	flags.StringVar(&ginMode, "gin-mode", "", "gin 运行模式: debug、release、test (FM_GIN_MODE)")
+	flags.Int64Var(&maxUploadSize, "max-upload-size", 0, "文件最大上传大小，单位字节 (FM_MAX_UPLOAD_SIZE)")
+	flags.StringVar(&theme, "theme", "", "页面主题: light、dark、auto (FM_THEME)")
+	flags.StringVar(&defaultLocale, "default-locale", "", "默认界面语言: zh-CN、en-US (FM_DEFAULT_LOCALE)")
+	flags.StringVar(&logLevel, "log-level", "", "日志级别: debug、info、warn、error (FM_LOG_LEVEL)")
+	flags.StringVar(&logFormat, "log-format", "", "日志格式: console、json (FM_LOG_FORMAT)")
+	flags.StringVar(&logFile, "log-file", "", "日志文件，为空时输出到标准错误 (FM_LOG_FILE)")
+	flags.StringVar(&guestPerms, "guest-permissions", "", "游客权限，逗号分隔，如 file:view,dir:view (FM_GUEST_PERMISSIONS)")
+	flags.StringVar(&usersFile, "users-file", "", "可热加载的用户文件，收到 SIGHUP 或文件变化时重新加载 (FM_USERS_FILE)")
+	flags.StringVar(&userStore, "user-store", "", "用户存储: memory、file、sqlite (FM_USER_STORE)")
+	flags.StringVar(&userStorePath, "user-store-path", "", "file 或 sqlite 用户存储的文件路径 (FM_USER_STORE_PATH)")
+	flags.StringVar(&jwtKeyDir, "jwt-key-dir", "", "JWT 密钥目录，目录中没有私钥时自动生成 (FM_JWT_KEY_DIR)")
+	flags.StringVar(&proxies, "trusted-proxies", "", "受信任的反向代理 IP 或 CIDR，逗号分隔，只有来自这些地址的 X-Forwarded-For 才会被采用 (FM_TRUSTED_PROXIES)")
+	flags.StringVar(&symlinkPolicy, "symlink-policy", "", "根目录中的符号链接: follow(只跟随指向根目录内的链接)、deny、allow (FM_SYMLINK_POLICY)")
+	flags.StringVar(&homeDir, "home-dir", "", "非管理员用户的家目录模板，相对根目录，如 home/{username} (FM_HOME_DIR)")
+	flags.BoolVar(&readOnly, "read-only", false, "全局只读，运行时可在 /file/admin/mode 中切换 (FM_READ_ONLY)")
+	flags.BoolVar(&maintenance, "maintenance", false, "维护模式，非管理员只能看到维护页面 (FM_MAINTENANCE)")
+	flags.StringVar(&maintenanceMsg, "maintenance-message", "", "维护页面的说明 (FM_MAINTENANCE_MESSAGE)")
+	flags.Var(&mounts, "mount", "挂载点，格式 名称=目录[,ro]，可重复，ro 表示只读 (FM_MOUNTS，分号分隔)")
+	flags.Var(&users, "user", "用户，格式 用户名:密码哈希[:角色[:权限1,权限2]]，可重复 (FM_USERS，分号分隔)")
+	if err := flags.Parse(args); err != nil {
+		return nil, "", err
+	}
+
+	cfg := fm.DefaultConfig()
+	if configPath != "" {
+		if err := cfg.LoadFile(configPath); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := loadEnv(cfg); err != nil {
+		return nil, "", err
+	}
+
+	// 只覆盖显式指定的命令行参数
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "root":
+			cfg.RootDir = rootDir
+		case "port":
+			cfg.Port = port
+		case "gin-mode":
+			cfg.GinMode = ginMode
+		case "max-upload-size":
+			cfg.MaxUploadSize = maxUploadSize
+		case "theme":
+			cfg.Theme = theme
+		case "default-locale":
+			cfg.DefaultLocale = defaultLocale
+		case "log-level":
+			cfg.Log.Level = logLevel
+		case "log-format":
+			cfg.Log.Format = logFormat
+		case "log-file":
+			cfg.Log.File = logFile
+		case "guest-permissions":
+			cfg.Guest.Permissions = splitList(guestPerms)
+		case "users-file":
+			cfg.UsersFile = usersFile
+		case "user-store":
+			cfg.UserStore.Type = userStore
+		case "user-store-path":
+			cfg.UserStore.Path = userStorePath
+		case "jwt-key-dir":
+			cfg.JWT.KeyDir = jwtKeyDir
+		case "trusted-proxies":
+			cfg.TrustedProxies = splitList(proxies)
+		case "symlink-policy":
+			cfg.SymlinkPolicy = symlinkPolicy
+		case "home-dir":
+			cfg.HomeDir = homeDir
+		case "read-only":
+			cfg.ReadOnly = readOnly
+		case "maintenance":
+			cfg.Maintenance = maintenance
+		case "maintenance-message":
+			cfg.MaintenanceMessage = maintenanceMsg
+		case "mount":
+			for _, spec := range mounts {
+				if specErr := addMountSpec(cfg, spec); specErr != nil && err == nil {
+					err = fmt.Errorf("-mount: %v", specErr)
+				}
+			}
+		case "user":
+			for _, spec := range users {
+				if specErr := addUserSpec(cfg, spec); specErr != nil && err == nil {
+					err = fmt.Errorf("-user: %v", specErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case hashPassword:
+		return cfg, modeHashPassword, nil
+	case generateKey:
+		return cfg, modeGenerateKey, nil
+	case printConfig:
+		return cfg, modePrintConfig, nil
+	}
+	return cfg, modeRun, nil
+}
+
+// 从输入的第一行读取密码并输出哈希
+func hashPassword(r io.Reader) error {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return errors.New("密码不能为空")
+	}
+	fmt.Println(fm.DefaultHashPassword(password))
+	return nil
+}
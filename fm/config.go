@@ -0,0 +1,567 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Config 文件管理器的声明式配置，可从 YAML、TOML、JSON 文件加载
+type Config struct {
+	RootDir            string                 `json:"root_dir"                     yaml:"root_dir"                     toml:"root_dir"`
+	SymlinkPolicy      string                 `json:"symlink_policy"               yaml:"symlink_policy"               toml:"symlink_policy"`                  // 根目录中的符号链接: follow 只跟随指向根目录内的链接，deny 拒绝，allow 不限制
+	HomeDir            string                 `json:"home_dir,omitempty"           yaml:"home_dir,omitempty"           toml:"home_dir,omitempty"`              // 非管理员用户的家目录模板，如 home/{username}，为空时不限制
+	Mounts             map[string]MountConfig `json:"mounts,omitempty"             yaml:"mounts,omitempty"             toml:"mounts,omitempty"`                // 挂载点，设置后根目录只列出挂载点，root_dir 不再使用
+	ReadOnly           bool                   `json:"read_only,omitempty"          yaml:"read_only,omitempty"          toml:"read_only,omitempty"`             // 全局只读，运行时可在 /file/admin/mode 中切换
+	Maintenance        bool                   `json:"maintenance,omitempty"        yaml:"maintenance,omitempty"        toml:"maintenance,omitempty"`           // 维护模式，非管理员只能看到维护页面
+	MaintenanceMessage string                 `json:"maintenance_message,omitempty" yaml:"maintenance_message,omitempty" toml:"maintenance_message,omitempty"` // 维护页面的说明
+	Port               int                    `json:"port"                         yaml:"port"                         toml:"port"`
+	GinMode            string                 `json:"gin_mode"                     yaml:"gin_mode"                     toml:"gin_mode"`
+	MaxUploadSize      int64                  `json:"max_upload_size"              yaml:"max_upload_size"              toml:"max_upload_size"`
+	CookieName         string                 `json:"cookie_name"                  yaml:"cookie_name"                  toml:"cookie_name"`
+	ThumbnailSize      int                    `json:"thumbnail_size"               yaml:"thumbnail_size"               toml:"thumbnail_size"`
+	ThumbnailCacheSize int64                  `json:"thumbnail_cache_size"         yaml:"thumbnail_cache_size"         toml:"thumbnail_cache_size"`
+	TemplatesDir       string                 `json:"templates_dir,omitempty"      yaml:"templates_dir,omitempty"      toml:"templates_dir,omitempty"` // 自定义模板目录，为空时使用内置模板
+	Theme              string                 `json:"theme"                        yaml:"theme"                        toml:"theme"`
+	SiteName           string                 `json:"site_name,omitempty"          yaml:"site_name,omitempty"          toml:"site_name,omitempty"`
+	LogoURL            string                 `json:"logo_url,omitempty"           yaml:"logo_url,omitempty"           toml:"logo_url,omitempty"`
+	DefaultLocale      string                 `json:"default_locale"               yaml:"default_locale"               toml:"default_locale"`
+	Log                LogConfig              `json:"log"                          yaml:"log"                          toml:"log"`
+	Users              map[string]UserConfig  `json:"users"                        yaml:"users"                        toml:"users"`
+	UsersFile          string                 `json:"users_file,omitempty"         yaml:"users_file,omitempty"         toml:"users_file,omitempty"` // 可热加载的用户文件，与 users 合并，同名时以该文件为准
+	Guest              UserConfig             `json:"guest"                        yaml:"guest"                        toml:"guest"`
+	Roles              map[string]RoleConfig  `json:"roles,omitempty"              yaml:"roles,omitempty"              toml:"roles,omitempty"`  // 命名角色，用户、组和 ldap、oidc 的组映射按名称引用
+	Groups             map[string]GroupConfig `json:"groups,omitempty"             yaml:"groups,omitempty"             toml:"groups,omitempty"` // 用户组，组成员拥有组内的所有角色
+	UserStore          UserStoreConfig        `json:"user_store"                   yaml:"user_store"                   toml:"user_store"`
+	LDAP               *LDAPConfig            `json:"ldap,omitempty"               yaml:"ldap,omitempty"               toml:"ldap,omitempty"` // 设置后优先通过 LDAP 认证，失败时回退到 user_store 中的本地用户
+	OIDC               *OIDCConfig            `json:"oidc,omitempty"               yaml:"oidc,omitempty"               toml:"oidc,omitempty"` // 设置后启用 OpenID Connect 单点登录
+	LoginLimit         LoginLimitConfig       `json:"login_limit"                  yaml:"login_limit"                  toml:"login_limit"`
+	Session            SessionConfig          `json:"session"                      yaml:"session"                      toml:"session"`
+	JWT                JWTKeyConfig           `json:"jwt"                          yaml:"jwt"                          toml:"jwt"`
+	TrustedProxies     []string               `json:"trusted_proxies,omitempty"    yaml:"trusted_proxies,omitempty"    toml:"trusted_proxies,omitempty"` // 反向代理的 IP 或 CIDR，只信任来自这些地址的 X-Forwarded-For，为空时使用连接地址
+}
+
+// 用户存储类型
+const (
+	UserStoreMemory = "memory" // users 和 users_file 组成的内存清单
+	UserStoreFile   = "file"   // JSON、YAML、TOML 文件
+	UserStoreSQLite = "sqlite" // 嵌入式 SQLite 数据库
+)
+
+// UserStoreConfig 用户存储配置，使用 file 或 sqlite 时 users 中的用户在存储中不存在时会被写入，便于初始化管理员
+type UserStoreConfig struct {
+	Type string `json:"type"           yaml:"type"           toml:"type"`
+	Path string `json:"path,omitempty" yaml:"path,omitempty" toml:"path,omitempty"`
+}
+
+// Duration 可以用 "5s"、"10m" 这样的字符串配置的时长
+type Duration time.Duration
+
+// MarshalText 实现 encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level  string `json:"level"  yaml:"level"  toml:"level"`  // debug、info、warn、error
+	Format string `json:"format" yaml:"format" toml:"format"` // json、console
+	File   string `json:"file"   yaml:"file"   toml:"file"`   // 为空时输出到标准错误
+}
+
+// UserConfig 用户配置
+type UserConfig struct {
+	PasswordHash     string     `json:"password_hash,omitempty"     yaml:"password_hash,omitempty"     toml:"password_hash,omitempty"`
+	Role             string     `json:"role,omitempty"              yaml:"role,omitempty"              toml:"role,omitempty"`
+	Roles            []string   `json:"roles,omitempty"             yaml:"roles,omitempty"             toml:"roles,omitempty"`  // 引用 roles 中定义的角色或内置的 admin
+	Groups           []string   `json:"groups,omitempty"            yaml:"groups,omitempty"            toml:"groups,omitempty"` // 所在的组，组内的角色同样生效
+	Permissions      []string   `json:"permissions,omitempty"       yaml:"permissions,omitempty"       toml:"permissions,omitempty"`
+	PathRestrictions []string   `json:"path_restrictions,omitempty" yaml:"path_restrictions,omitempty" toml:"path_restrictions,omitempty"`
+	PathBlocking     []string   `json:"path_blocking,omitempty"     yaml:"path_blocking,omitempty"     toml:"path_blocking,omitempty"`
+	IP               string     `json:"ip,omitempty"                yaml:"ip,omitempty"                toml:"ip,omitempty"`
+	AllowedIPs       []string   `json:"allowed_ips,omitempty"       yaml:"allowed_ips,omitempty"       toml:"allowed_ips,omitempty"` // 允许登录和访问的 IP 或 CIDR，与 ip 合并，为空时不限制
+	Locale           string     `json:"locale,omitempty"            yaml:"locale,omitempty"            toml:"locale,omitempty"`
+	TOTPSecret       string     `json:"totp_secret,omitempty"       yaml:"totp_secret,omitempty"       toml:"totp_secret,omitempty"`    // 两步验证密钥，通常在设置页面中绑定
+	RecoveryCodes    []string   `json:"recovery_codes,omitempty"    yaml:"recovery_codes,omitempty"    toml:"recovery_codes,omitempty"` // 恢复码的 SHA-256
+	APITokens        []APIToken `json:"api_tokens,omitempty"        yaml:"api_tokens,omitempty"        toml:"api_tokens,omitempty"`     // 个人 API token，通常在设置页面中创建
+	ACL              []ACLRule  `json:"acl,omitempty"               yaml:"acl,omitempty"               toml:"acl,omitempty"`            // 按路径授予或拒绝的权限，优先于 permissions
+	Home             string     `json:"home,omitempty"              yaml:"home,omitempty"              toml:"home,omitempty"`           // 家目录，相对 root_dir，优先于 home_dir，/ 表示不限制
+	OIDCSubject      string     `json:"oidc_subject,omitempty"      yaml:"oidc_subject,omitempty"      toml:"oidc_subject,omitempty"`   // 绑定的 OIDC 账户(ID token 的 sub)，OIDC 登录只通过它关联本地用户
+}
+
+// DefaultConfig 默认配置，除 GinMode 外与 NewFileManager 的默认值保持一致；
+// 命令行和配置文件面向部署，GinMode 默认为 release，NewFileManager 作为库使用时默认为 debug
+func DefaultConfig() *Config {
+	return &Config{
+		RootDir:            ".",
+		SymlinkPolicy:      SymlinkFollow,
+		Port:               8080,
+		GinMode:            gin.ReleaseMode,
+		MaxUploadSize:      10 << 30,
+		CookieName:         "fm_session",
+		ThumbnailSize:      defaultThumbnailSize,
+		ThumbnailCacheSize: defaultThumbnailCacheSize,
+		Theme:              ThemeLight,
+		DefaultLocale:      LocaleZhCN,
+		Log: LogConfig{
+			Level:  "info",
+			Format: "console",
+		},
+		Users: map[string]UserConfig{},
+		Guest: UserConfig{
+			Permissions:      []string{PermissionFileView, PermissionDirView},
+			PathRestrictions: []string{"/"},
+		},
+		UserStore:  UserStoreConfig{Type: UserStoreMemory},
+		LoginLimit: DefaultLoginLimitConfig(),
+		Session:    DefaultSessionConfig(),
+	}
+}
+
+// LoadConfig 在默认配置的基础上读取配置文件
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if err := cfg.LoadFile(path); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// RedactedValue 输出配置时替换密码哈希、密钥等敏感字段的占位符
+const RedactedValue = "<redacted>"
+
+// Redacted 返回去掉敏感字段的副本，用于输出或记录配置，原配置不变
+func (cfg *Config) Redacted() *Config {
+	redacted := *cfg
+	redactString := func(value *string) {
+		if *value != "" {
+			*value = RedactedValue
+		}
+	}
+	redactUser := func(uc UserConfig) UserConfig {
+		redactString(&uc.PasswordHash)
+		redactString(&uc.TOTPSecret)
+		if len(uc.RecoveryCodes) > 0 {
+			uc.RecoveryCodes = []string{RedactedValue}
+		}
+		tokens := make([]APIToken, len(uc.APITokens))
+		for i, token := range uc.APITokens {
+			redactString(&token.Hash)
+			tokens[i] = token
+		}
+		if uc.APITokens != nil {
+			uc.APITokens = tokens
+		}
+		return uc
+	}
+
+	if cfg.Users != nil {
+		redacted.Users = make(map[string]UserConfig, len(cfg.Users))
+		for username, uc := range cfg.Users {
+			redacted.Users[username] = redactUser(uc)
+		}
+	}
+	redacted.Guest = redactUser(cfg.Guest)
+	if cfg.LDAP != nil {
+		ldap := *cfg.LDAP
+		redactString(&ldap.BindPassword)
+		redacted.LDAP = &ldap
+	}
+	if cfg.OIDC != nil {
+		oidc := *cfg.OIDC
+		redactString(&oidc.ClientSecret)
+		redacted.OIDC = &oidc
+	}
+	return &redacted
+}
+
+// LoadFile 按扩展名读取 YAML、TOML 或 JSON 配置文件，未知字段视为错误
+func (cfg *Config) LoadFile(path string) error {
+	return decodeConfigFile(path, cfg)
+}
+
+// 按扩展名解码 YAML、TOML 或 JSON 文件，未知字段视为错误
+func decodeConfigFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalWithOptions(data, v, yaml.Strict())
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(v)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(v)
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+// Validate 校验全部配置项，返回所有错误的合集
+func (cfg *Config) Validate() error {
+	var errs []error
+	addErr := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if cfg.RootDir == "" {
+		addErr("root_dir", "不能为空")
+	} else if info, err := os.Stat(cfg.RootDir); err != nil {
+		addErr("root_dir", "%v", err)
+	} else if !info.IsDir() {
+		addErr("root_dir", "%s 不是目录", cfg.RootDir)
+	}
+	if err := validateHomeDir(cfg.HomeDir); err != nil {
+		addErr("home_dir", "%q %v", cfg.HomeDir, err)
+	}
+	if err := validateSymlinkPolicy(cfg.SymlinkPolicy); err != nil {
+		addErr("symlink_policy", "%v", err)
+	}
+	errs = append(errs, validateMounts(cfg.Mounts)...)
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		addErr("port", "%d 不在 1-65535 范围内", cfg.Port)
+	}
+	switch cfg.GinMode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		addErr("gin_mode", "%q 应为 debug、release 或 test", cfg.GinMode)
+	}
+	if cfg.MaxUploadSize <= 0 {
+		addErr("max_upload_size", "必须大于 0")
+	}
+	if cfg.CookieName == "" {
+		addErr("cookie_name", "不能为空")
+	}
+	if cfg.ThumbnailSize <= 0 {
+		addErr("thumbnail_size", "必须大于 0")
+	}
+	if cfg.ThumbnailCacheSize <= 0 {
+		addErr("thumbnail_cache_size", "必须大于 0")
+	}
+	if cfg.TemplatesDir != "" {
+		if info, err := os.Stat(cfg.TemplatesDir); err != nil {
+			addErr("templates_dir", "%v", err)
+		} else if !info.IsDir() {
+			addErr("templates_dir", "%s 不是目录", cfg.TemplatesDir)
+		}
+	}
+	if !defaultMessageCatalog.supports(cfg.DefaultLocale) {
+		addErr("default_locale", "不支持的语言 %q", cfg.DefaultLocale)
+	}
+	if _, err := zapcore.ParseLevel(cfg.Log.Level); err != nil {
+		addErr("log.level", "%v", err)
+	}
+	switch cfg.Log.Format {
+	case "console", "json":
+	default:
+		addErr("log.format", "%q 应为 console 或 json", cfg.Log.Format)
+	}
+
+	subjects := map[string]string{}
+	for _, username := range slices.Sorted(maps.Keys(cfg.Users)) {
+		user := cfg.Users[username]
+		field := "users." + username
+		if err := validatePasswordHash(user.PasswordHash); err != nil {
+			addErr(field+".password_hash", "%v", err)
+		}
+		errs = append(errs, user.validate(field)...)
+		errs = append(errs, validateUserRoles(field, user, cfg.Roles, cfg.Groups)...)
+		if user.OIDCSubject != "" {
+			if other, ok := subjects[user.OIDCSubject]; ok {
+				addErr(field+".oidc_subject", "%q 已绑定到用户 %s", user.OIDCSubject, other)
+			}
+			subjects[user.OIDCSubject] = username
+		}
+	}
+	errs = append(errs, cfg.Guest.validate("guest")...)
+	errs = append(errs, validateUserRoles("guest", cfg.Guest, cfg.Roles, cfg.Groups)...)
+	errs = append(errs, validateRoles(cfg.Roles, cfg.Groups)...)
+	if cfg.LDAP != nil {
+		errs = append(errs, validateGroupMappingRoles("ldap.groups", cfg.LDAP.Groups, cfg.Roles)...)
+	}
+	if cfg.OIDC != nil {
+		errs = append(errs, validateGroupMappingRoles("oidc.groups", cfg.OIDC.Groups, cfg.Roles)...)
+	}
+	if cfg.UsersFile != "" {
+		if _, err := LoadUsersFile(cfg.UsersFile); err != nil {
+			addErr("users_file", "%v", err)
+		}
+	}
+	switch cfg.UserStore.Type {
+	case UserStoreMemory:
+	case UserStoreFile, UserStoreSQLite:
+		if cfg.UserStore.Path == "" {
+			addErr("user_store.path", "使用 %s 存储时不能为空", cfg.UserStore.Type)
+		}
+		if cfg.UsersFile != "" {
+			addErr("users_file", "只能与 memory 用户存储一起使用")
+		}
+	default:
+		addErr("user_store.type", "%q 应为 memory、file 或 sqlite", cfg.UserStore.Type)
+	}
+	if cfg.LDAP != nil {
+		if err := cfg.LDAP.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.OIDC != nil {
+		if err := cfg.OIDC.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := cfg.LoginLimit.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.Session.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.JWT.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, validateIPRules("trusted_proxies", cfg.TrustedProxies)...)
+
+	return errors.Join(errs...)
+}
+
+// 校验用户的权限名称、路径规则和语言
+func (uc UserConfig) validate(field string) []error {
+	var errs []error
+	for _, permission := range uc.Permissions {
+		if !IsValidPermission(permission) {
+			errs = append(errs, fmt.Errorf("%s.permissions: 未知权限 %q", field, permission))
+		}
+	}
+	for _, pattern := range uc.PathRestrictions {
+		if err := validatePathPattern(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("%s.path_restrictions: %q 无法编译: %v", field, pattern, err))
+		}
+	}
+	for _, pattern := range uc.PathBlocking {
+		if err := validatePathPattern(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("%s.path_blocking: %q 无法编译: %v", field, pattern, err))
+		}
+	}
+	if uc.Locale != "" && !defaultMessageCatalog.supports(uc.Locale) {
+		errs = append(errs, fmt.Errorf("%s.locale: 不支持的语言 %q", field, uc.Locale))
+	}
+	if uc.TOTPSecret != "" {
+		if err := validateTOTPSecret(uc.TOTPSecret); err != nil {
+			errs = append(errs, fmt.Errorf("%s.totp_secret: %v", field, err))
+		}
+	}
+	for _, code := range uc.RecoveryCodes {
+		if !isRecoveryCodeHash(code) {
+			errs = append(errs, fmt.Errorf("%s.recovery_codes: %q 不是 SHA-256", field, code))
+		}
+	}
+	if uc.IP != "" {
+		if _, err := parseIPRule(uc.IP); err != nil {
+			errs = append(errs, fmt.Errorf("%s.ip: %q 不是合法的 IP 或 CIDR", field, uc.IP))
+		}
+	}
+	errs = append(errs, validateIPRules(field+".allowed_ips", uc.AllowedIPs)...)
+	errs = append(errs, validateAPITokens(field+".api_tokens", uc.APITokens)...)
+	errs = append(errs, validateACL(field+".acl", uc.ACL)...)
+	if err := validateHomeDir(uc.Home); err != nil {
+		errs = append(errs, fmt.Errorf("%s.home: %q %v", field, uc.Home, err))
+	}
+	return errs
+}
+
+// ToUser 转换为 User
+func (uc UserConfig) ToUser(username string) User {
+	permissions := make(map[string]bool, len(uc.Permissions))
+	for _, permission := range uc.Permissions {
+		permissions[permission] = true
+	}
+	return User{
+		Username:                 username,
+		EncryptPassword:          uc.PasswordHash,
+		Role:                     uc.Role,
+		Roles:                    uc.Roles,
+		Groups:                   uc.Groups,
+		Permissions:              permissions,
+		BaseRolePathRestrictions: uc.PathRestrictions,
+		BaseRolePathBlocking:     uc.PathBlocking,
+		IP:                       uc.IP,
+		AllowedIPs:               uc.AllowedIPs,
+		Locale:                   uc.Locale,
+		TOTPSecret:               uc.TOTPSecret,
+		RecoveryCodes:            uc.RecoveryCodes,
+		APITokens:                uc.APITokens,
+		ACL:                      uc.ACL,
+		Home:                     uc.Home,
+		OIDCSubject:              uc.OIDCSubject,
+	}
+}
+
+// Build 按配置创建日志
+func (lc LogConfig) Build() (*zap.Logger, error) {
+	level, err := zapcore.ParseLevel(lc.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = zap.NewAtomicLevelAt(level)
+	zapConfig.Encoding = lc.Format
+	zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	zapConfig.Sampling = nil
+	if lc.File != "" {
+		zapConfig.OutputPaths = []string{lc.File}
+		zapConfig.ErrorOutputPaths = []string{lc.File}
+	}
+	return zapConfig.Build()
+}
+
+// NewFromConfig 校验配置并创建文件管理器，logger 为空时按 cfg.Log 创建，校验失败时返回所有错误
+func NewFromConfig(cfg *Config, logger *zap.Logger) (*FileManager, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		var err error
+		if logger, err = cfg.Log.Build(); err != nil {
+			return nil, fmt.Errorf("初始化日志失败: %v", err)
+		}
+	}
+
+	fm, err := newFileManager(cfg.RootDir, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// 模板、语言、主题依赖自定义目录中的文件，需要在创建后再校验
+	var errs []error
+	if cfg.TemplatesDir != "" {
+		if err = fm.setTemplates(os.DirFS(cfg.TemplatesDir)); err != nil {
+			errs = append(errs, fmt.Errorf("templates_dir: %v", err))
+		}
+	}
+	if err = fm.setDefaultLocale(cfg.DefaultLocale); err != nil {
+		errs = append(errs, fmt.Errorf("default_locale: %v", err))
+	}
+	if err = fm.setTheme(cfg.Theme); err != nil {
+		errs = append(errs, fmt.Errorf("theme: %v", err))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	users := make(map[string]User, len(cfg.Users))
+	for username, user := range cfg.Users {
+		users[username] = user.ToUser(username)
+	}
+
+	fm.SetPort(strconv.Itoa(cfg.Port)).
+		SetGinMode(cfg.GinMode).
+		SetMaxUploadSize(cfg.MaxUploadSize).
+		SetCookieName(cfg.CookieName).
+		SetThumbnailSize(cfg.ThumbnailSize).
+		SetThumbnailCacheSize(cfg.ThumbnailCacheSize).
+		SetBranding(cfg.SiteName, cfg.LogoURL).
+		SetUsers(users).
+		SetGuestUser(cfg.Guest.ToUser("guest")).
+		SetRoles(cfg.Roles, cfg.Groups).
+		SetLoginLimit(cfg.LoginLimit).
+		SetTrustedProxies(cfg.TrustedProxies).
+		SetSymlinkPolicy(cfg.SymlinkPolicy).
+		SetHomeDir(cfg.HomeDir).
+		SetReadOnly(cfg.ReadOnly).
+		SetMaintenance(cfg.Maintenance, cfg.MaintenanceMessage)
+	if err = fm.setMounts(cfg.Mounts); err != nil {
+		return nil, fmt.Errorf("mounts: %v", err)
+	}
+	if cfg.JWT.configured() {
+		if err = fm.setJWTKeys(cfg.JWT); err != nil {
+			return nil, fmt.Errorf("jwt: %v", err)
+		}
+	}
+	if err = fm.setSession(cfg.Session); err != nil {
+		return nil, fmt.Errorf("session: %v", err)
+	}
+	if cfg.UsersFile != "" {
+		if err = fm.setUsersFile(cfg.UsersFile); err != nil {
+			return nil, fmt.Errorf("users_file: %v", err)
+		}
+	}
+	if err = fm.openUserStore(cfg.UserStore, users); err != nil {
+		return nil, fmt.Errorf("user_store: %v", err)
+	}
+	if cfg.LDAP != nil {
+		ldapAuth, err := NewLDAPAuthenticator(*cfg.LDAP, fm.userStore)
+		if err != nil {
+			return nil, err
+		}
+		fm.SetUserStore(ldapAuth)
+	}
+	if cfg.OIDC != nil {
+		if err = fm.setOIDC(*cfg.OIDC); err != nil {
+			return nil, err
+		}
+	}
+	return fm, nil
+}
+
+// 打开配置的用户存储，并写入存储中还不存在的用户
+func (fm *FileManager) openUserStore(cfg UserStoreConfig, seed map[string]User) error {
+	var (
+		store UserStore
+		err   error
+	)
+	switch cfg.Type {
+	case UserStoreFile:
+		store, err = NewFileUserStore(cfg.Path, fm.hashPassword)
+	case UserStoreSQLite:
+		store, err = NewSQLiteUserStore(cfg.Path, fm.hashPassword)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, username := range slices.Sorted(maps.Keys(seed)) {
+		if err = store.Create(seed[username]); err != nil && !errors.Is(err, ErrUserExists) {
+			return fmt.Errorf("写入用户 %s 失败: %v", username, err)
+		}
+	}
+	fm.SetUserStore(store)
+	return nil
+}
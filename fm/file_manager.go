@@ -4,15 +4,17 @@ package fm
 import (
 	"bytes"
 	"crypto/rsa"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,54 +23,91 @@ import (
 )
 
 type FileManager struct {
-	rootDir       string              // 目录
+	files         *rootFS             // 根目录，请求路径经过解析后才能访问
 	maxUploadSize int64               // 文件最大上传大小
 	cookieName    string              // cookie 名称
-	maxAge        int                 // cookie 存续时间
-	privateKey    *rsa.PrivateKey     // 私钥
-	publicKey     *rsa.PublicKey      // 公钥
+	maxAge        int                 // cookie 存续时间，与刷新 token 的有效期一致
+	jwtKeys       *jwtKeyRing         // JWT 签名私钥和验证公钥
+	proxies       []string            // 受信任的反向代理地址，为空时不信任 X-Forwarded-For
+	homeDir       string              // 非管理员用户的家目录模板，为空时不限制
+	mode          serviceMode         // 全局只读和维护模式
 	port          string              // 端口
 	hashPassword  func(string) string // 密码加密函数
-	users         map[string]User     // 用户清单
-	guestUser     User                // 默认游客权限
+	users         *userRegistry       // 用户清单及默认游客权限
+	roles         *roleRegistry       // 命名角色和用户组
+	usersFile     string              // 用户文件，支持热加载
+	userStore     UserStore           // 用户存储，默认为 users
+	oidc          *oidcProvider       // OpenID Connect 单点登录，为空时不启用
+	loginLimiter  *loginLimiter       // 登录失败限制
+	totpGuard     *totpReplayGuard    // 防止两步验证码重复使用
+	userLocks     sync.Map            // 用户名到 *sync.Mutex，用户存储不支持原子修改时串行使用恢复码
+	sessions      *sessionStore       // 会话和已撤销的访问 token
 	ginMode       string              // gin的mode
 	log           *zap.SugaredLogger  // 日志
 	handlerFunc   []gin.HandlerFunc
 	AuditLogs     []AuditLog
 	localIP       string
+	thumbnailSize int                // 缩略图边长
+	thumbnails    *thumbnailCache    // 缩略图缓存
+	templates     *template.Template // 页面模板
+	uiFS          fs.FS              // 模板和静态资源
+	customUIFS    fs.FS              // 自定义模板和静态资源
+	messages      *messageCatalog    // 消息目录
+	siteName      string             // 站点名称
+	logoURL       string             // Logo地址
+	theme         string             // 页面主题
 }
 
-// DefaultHashPassword 默认帐户密码加密规则
-func DefaultHashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hash[:])
+// NewFileManager 创建文件管理器，失败时打印错误并返回 nil，需要错误信息时使用 NewFromConfig
+func NewFileManager(dir string, logger *zap.Logger) *FileManager {
+	fm, err := newFileManager(dir, logger)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return fm
 }
 
-func NewFileManager(dir string, logger *zap.Logger) *FileManager {
+func newFileManager(dir string, logger *zap.Logger) (*FileManager, error) {
 	privateKey, publicKey, err := generateRSAKeyPair()
 	if err != nil {
-		fmt.Printf("生成RSA密钥对失败: %v\n", err)
-		return nil
+		return nil, fmt.Errorf("生成RSA密钥对失败: %v", err)
 	}
-	return &FileManager{
-		rootDir:       dir,
+	templates, err := parseTemplates(nil)
+	if err != nil {
+		return nil, fmt.Errorf("解析页面模板失败: %v", err)
+	}
+	fm := &FileManager{
+		files:         newRootFS(dir),
 		maxUploadSize: 10 << 30,
 		cookieName:    "fm_session",
-		privateKey:    privateKey,
-		publicKey:     publicKey,
 		maxAge:        36000,
 		port:          "8080",
+		ginMode:       gin.DebugMode,
 		hashPassword:  DefaultHashPassword,
 		log:           logger.Sugar(),
-		guestUser: User{
-			Username: "guest",
-			Permissions: map[string]bool{
-				PermissionFileView: true,
-				PermissionDirView:  true,
-			},
-			BaseRolePathRestrictions: []string{"/"},
-		},
+		thumbnailSize: defaultThumbnailSize,
+		thumbnails:    newThumbnailCache(defaultThumbnailCacheSize),
+		templates:     templates,
+		uiFS:          defaultUIFS,
+		messages:      defaultMessageCatalog,
+		theme:         ThemeLight,
+		loginLimiter:  newLoginLimiter(DefaultLoginLimitConfig()),
+		totpGuard:     newTOTPReplayGuard(),
+		jwtKeys:       newJWTKeyRing(newJWTKeySet(privateKey, publicKey)),
+		roles:         newRoleRegistry(),
 	}
+	fm.users = newUserRegistry(User{
+		Username: "guest",
+		Permissions: map[string]bool{
+			PermissionFileView: true,
+			PermissionDirView:  true,
+		},
+		BaseRolePathRestrictions: []string{"/"},
+	})
+	fm.userStore = fm.users
+	fm.sessions, _ = newSessionStore(DefaultSessionConfig()) // 不读取文件，不会失败
+	return fm, nil
 }
 
 func (fm *FileManager) SetMaxUploadSize(maxUploadSize int64) *FileManager {
@@ -76,14 +115,46 @@ func (fm *FileManager) SetMaxUploadSize(maxUploadSize int64) *FileManager {
 	return fm
 }
 
+// SetThumbnailSize 设置缩略图最大边长(像素)，必须大于 0
+func (fm *FileManager) SetThumbnailSize(size int) *FileManager {
+	if err := fm.setThumbnailSize(size); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setThumbnailSize(size int) error {
+	if size <= 0 {
+		return fmt.Errorf("thumbnail_size: %d 必须大于 0", size)
+	}
+	fm.thumbnailSize = size
+	return nil
+}
+
+// SetThumbnailCacheSize 设置缩略图缓存上限(字节)，必须大于 0
+func (fm *FileManager) SetThumbnailCacheSize(maxBytes int64) *FileManager {
+	if err := fm.setThumbnailCacheSize(maxBytes); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setThumbnailCacheSize(maxBytes int64) error {
+	if maxBytes <= 0 {
+		return fmt.Errorf("thumbnail_cache_size: %d 必须大于 0", maxBytes)
+	}
+	fm.thumbnails.setMaxBytes(maxBytes)
+	return nil
+}
+
 func (fm *FileManager) SetCookieName(name string) *FileManager {
 	fm.cookieName = name
 	return fm
 }
 
+// SetKey 设置签名私钥，publicKey 为空或与私钥不同时也用于验证，需要从文件加载或轮换密钥时使用 SetJWTKeys
 func (fm *FileManager) SetKey(privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey) *FileManager {
-	fm.privateKey = privateKey
-	fm.publicKey = publicKey
+	fm.jwtKeys.keys.Store(newJWTKeySet(privateKey, publicKey))
 	return fm
 }
 
@@ -92,18 +163,38 @@ func (fm *FileManager) SetPort(port string) *FileManager {
 	return fm
 }
 
+// SetHashPassword 设置新密码的加密规则，默认为 argon2id，校验时自动识别 argon2id、bcrypt 和旧版 SHA-256
 func (fm *FileManager) SetHashPassword(password func(string) string) *FileManager {
 	fm.hashPassword = password
+	fm.users.setHashPassword(password)
 	return fm
 }
 
 func (fm *FileManager) SetUsers(users map[string]User) *FileManager {
-	fm.users = users
+	if err := fm.setUsers(users); err != nil {
+		fm.log.Error(err)
+	}
 	return fm
 }
 
+func (fm *FileManager) setUsers(users map[string]User) error {
+	var errs []error
+	for username, user := range users {
+		errs = append(errs, validateUserRules("users."+username, user)...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	fm.users.setStatic(users)
+	return nil
+}
+
 func (fm *FileManager) SetGuestUser(guestUser User) *FileManager {
-	fm.guestUser = guestUser
+	if err := errors.Join(validateUserRules("guest", guestUser)...); err != nil {
+		fm.log.Error(err)
+		return fm
+	}
+	fm.users.setStaticGuest(guestUser)
 	return fm
 }
 
@@ -118,7 +209,6 @@ func (fm *FileManager) SetGinMode(mode string) *FileManager {
 	default:
 		fm.ginMode = gin.DebugMode
 	}
-	fm.ginMode = mode
 	return fm
 }
 
@@ -143,6 +233,7 @@ type AuditLog struct {
 	EndTime    time.Time `json:"end_time"    spark:"column:end_time;type:timestamp_us"`
 	Latency    string    `json:"latency"     spark:"column:latency"`
 	Error      string    `json:"error"       spark:"column:error"`
+	Event      string    `json:"event"       spark:"column:event"`
 }
 
 func getServerIP() (string, error) {
@@ -174,8 +265,9 @@ func responseLogger() gin.HandlerFunc {
 
 		c.Next()
 
+		// respondError 已记录本地化的错误消息时不再用响应体覆盖
 		responseBody := blw.body.String()
-		if blw.Status() >= 400 {
+		if _, exists := c.Get("errorMessage"); blw.Status() >= 400 && !exists {
 			c.Set("errorMessage", responseBody)
 		}
 	}
@@ -204,6 +296,7 @@ func (fm *FileManager) ginZapLogger() gin.HandlerFunc {
 		method := c.Request.Method
 		uri := c.Request.RequestURI
 		errorMessage, _ := c.Get("errorMessage")
+		event := c.GetString("auditEvent")
 
 		var al AuditLog
 		al.Ts = startTime
@@ -216,6 +309,7 @@ func (fm *FileManager) ginZapLogger() gin.HandlerFunc {
 		al.EndTime = endTime
 		al.Latency = fmt.Sprintf("%s", latency)
 		al.Error = fmt.Sprintf("%s", errorMessage)
+		al.Event = event
 
 		logger := fm.log.With(
 			zap.String("method", method),
@@ -226,6 +320,9 @@ func (fm *FileManager) ginZapLogger() gin.HandlerFunc {
 			zap.String("start_time", startTime.Format("2006-01-02 15:04:05.000000")),
 			zap.Duration("latency", latency),
 		)
+		if event != "" {
+			logger = logger.With(zap.String("audit_event", event))
+		}
 
 		if statusCode >= 500 {
 			logger.Errorf("request failed ,err is: %s", errorMessage)
@@ -241,72 +338,118 @@ func (fm *FileManager) recovery() gin.HandlerFunc {
 	return gin.Recovery()
 }
 
-func (fm *FileManager) Run() {
+// Run 启动服务，监听失败时返回错误
+func (fm *FileManager) Run() error {
 	defer fm.log.Sync()
 	gin.SetMode(fm.ginMode)
-	engine := gin.New()
 	if ip, err := getServerIP(); err != nil {
 		fm.log.Warn(err.Error())
 	} else {
 		fm.localIP = ip
 	}
 
+	fm.resolveAllUsers()
+	fm.watchUsersFile()
+	fm.watchJWTKeys()
+
+	if err := fm.engine().Run(":" + fm.port); err != nil {
+		fm.log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// 创建注册了所有中间件和路由的 gin 引擎
+func (fm *FileManager) engine() *gin.Engine {
+	engine := gin.New()
+	if err := engine.SetTrustedProxies(fm.proxies); err != nil {
+		fm.log.Error(err)
+	}
+
 	engine.Use(fm.ginZapLogger())
 	engine.Use(responseLogger())
 	engine.Use(fm.recovery())
+	engine.Use(fm.localeMiddleware())
 	engine.Use(fm.handlerFunc...)
 
+	engine.GET("/file/static/*filepath", fm.handleStatic)
+	engine.GET("/.well-known/jwks.json", fm.handleJWKS)
 	engine.GET("/file/login", fm.showLoginForm)
 	engine.POST("/file/login", fm.handleLogin)
 	engine.GET("/file/logout", fm.handleLogout)
+	engine.POST("/file/token/refresh", fm.handleTokenRefresh)
+	engine.GET("/file/login/2fa", fm.showTOTPLogin)
+	engine.POST("/file/login/2fa", fm.handleTOTPLogin)
+	if fm.oidc != nil {
+		engine.GET("/file/login/oidc", fm.handleOIDCLogin)
+		engine.GET("/file/login/oidc/callback", fm.handleOIDCCallback)
+	}
 
-	authorized := engine.Group("/", fm.jwtAuthMiddleware())
+	authorized := engine.Group("/", fm.sameOriginMiddleware(), fm.jwtAuthMiddleware(), fm.maintenanceMiddleware())
 	{
 		authorized.GET("/file", fm.requirePermission(PermissionDirView), fm.handleFileManager)
+		authorized.GET("/file/thumbnail", fm.requirePermission(PermissionFileView), fm.checkPathPermission(), fm.handleThumbnail)
 		authorized.GET("/file/download", fm.requirePermission(PermissionFileDownload), fm.checkPathPermission(), fm.handleFileDownload)
-		authorized.POST("/file/upload", fm.requirePermission(PermissionDirUpload), fm.checkPathPermission(), fm.handleFileUpload)
+		authorized.POST("/file/upload", fm.limitUploadBody(), fm.requirePermission(PermissionDirUpload), fm.checkPathPermission(), fm.handleFileUpload)
 		authorized.GET("/file/edit", fm.requirePermission(PermissionFileEdit), fm.checkPathPermission(), fm.handleFileEditor)
 		authorized.POST("/file/action", fm.requirePermission(PermissionDirView), fm.checkPathPermission(), fm.handleFileAction)
+		authorized.GET("/file/settings/2fa", fm.showTOTPSettings)
+		authorized.POST("/file/settings/2fa/enable", fm.handleTOTPEnable)
+		authorized.POST("/file/settings/2fa/disable", fm.handleTOTPDisable)
+		authorized.POST("/file/settings/2fa/recovery", fm.handleRecoveryCodes)
+		authorized.GET("/file/settings/tokens", fm.showAPITokens)
+		authorized.POST("/file/settings/tokens", fm.handleAPITokenCreate)
+		authorized.POST("/file/settings/tokens/revoke", fm.handleAPITokenRevoke)
+		authorized.GET("/file/settings/sessions", fm.showSessions)
+		authorized.POST("/file/settings/sessions/revoke", fm.handleSessionRevoke)
+		authorized.POST("/file/logout/all", fm.handleLogoutAll)
+		authorized.GET("/file/admin/sessions", fm.requireAdmin(), fm.showAdminSessions)
+		authorized.POST("/file/admin/sessions/revoke", fm.requireAdmin(), fm.handleAdminSessionRevoke)
+		authorized.GET("/file/admin/mode", fm.requireAdmin(), fm.showAdminMode)
+		authorized.POST("/file/admin/mode", fm.requireAdmin(), fm.handleAdminMode)
 	}
-
-	err := engine.Run(":" + fm.port)
-	if err != nil {
-		fm.log.Error(err)
-	}
+	return engine
 }
 
 func (fm *FileManager) handleFileManager(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		user = fm.guestUser
+		user = fm.guest()
 	}
 
-	path := c.Query("path")
+	path := requestPath(c)
 	editMode := c.Query("edit") == "true"
-	fullPath := filepath.Join(fm.rootDir, path)
-	html := fm.generateFileManagerHTML(fullPath, path, editMode, user.(User))
-	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+
+	// 目录展示模式，记录在cookie中以便切换目录时保持
+	viewMode := c.Query("view")
+	if viewMode == ViewModeList || viewMode == ViewModeGallery {
+		c.SetCookie(fm.cookieName+"_view", viewMode, fm.maxAge, "/", "", false, true)
+	} else if viewMode, _ = c.Cookie(fm.cookieName + "_view"); viewMode != ViewModeGallery {
+		viewMode = ViewModeList
+	}
+
+	fm.renderFileManager(c, path, editMode, viewMode, user.(User))
 }
 
 // 文件下载
 func (fm *FileManager) handleFileDownload(c *gin.Context) {
-	path := c.Query("path")
-	fullPath := filepath.Join(fm.rootDir, path)
+	path := requestPath(c)
+	root := fm.requestFiles(c)
 
-	fileInfo, err := os.Stat(fullPath)
+	fileInfo, err := root.Stat(path)
 	if err != nil {
-		c.String(http.StatusNotFound, "文件不存在: %v", err)
+		fm.respondError(c, http.StatusNotFound, "file.not_exist", err)
 		return
 	}
 
 	if fileInfo.IsDir() {
-		c.String(http.StatusBadRequest, "不能下载目录")
+		fm.respondError(c, http.StatusBadRequest, "download.is_dir")
 		return
 	}
 
 	var file *os.File
-	if file, err = os.Open(fullPath); err != nil {
-		c.String(http.StatusInternalServerError, "无法打开文件: %v", err)
+	if file, err = root.Open(path); err != nil {
+		fm.respondError(c, http.StatusInternalServerError, "download.open_failed", err)
 		return
 	}
 	defer file.Close()
@@ -317,51 +460,91 @@ func (fm *FileManager) handleFileDownload(c *gin.Context) {
 
 	_, err = io.Copy(c.Writer, file)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "下载文件失败: %v", err)
+		fm.respondError(c, http.StatusInternalServerError, "download.failed", err)
 		return
 	}
 }
 
+// 上传请求体中除文件外的表单字段和分隔符的余量
+const uploadFormOverhead = 1 << 20
+
+// 上传请求在解析表单前限制请求体大小。path 放在请求体中时，权限中间件读取 path 需要先解析整个表单，
+// 此时还不知道目标位置，按所有位置中最大的限制解析，具体位置的限制由 handleFileUpload 检查
+func (fm *FileManager) limitUploadBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("path") == "" && !fm.parseUploadForm(c, fm.files.maxUploadLimit(fm.maxUploadSize)) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 限制请求体大小后解析上传表单，超出限制时返回 413，表单已解析时不再读取请求体
+func (fm *FileManager) parseUploadForm(c *gin.Context, limit int64) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+uploadFormOverhead)
+	err := c.Request.ParseMultipartForm(limit)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &tooLarge):
+		fm.respondError(c, http.StatusRequestEntityTooLarge, "upload.too_large", formatFileSize(limit))
+	default:
+		fm.respondError(c, http.StatusBadRequest, "upload.too_large", err)
+	}
+	return false
+}
+
 // 处理文件上传
 func (fm *FileManager) handleFileUpload(c *gin.Context) {
-	path := c.PostForm("path")
-	targetDir := filepath.Join(fm.rootDir, path)
+	path := requestPath(c)
+	root := fm.requestFiles(c)
 	user := c.MustGet("user").(User)
 
-	fileInfo, err := os.Stat(targetDir)
+	fileInfo, err := root.Stat(path)
 	if err != nil || !fileInfo.IsDir() {
-		c.String(http.StatusBadRequest, "目标目录不存在或不是目录: %v", err)
+		fm.respondError(c, http.StatusBadRequest, "upload.bad_target", err)
 		return
 	}
 
-	if err = c.Request.ParseMultipartForm(fm.maxUploadSize); err != nil {
-		c.String(http.StatusBadRequest, "上传文件过大: %v", err)
+	if reason := fm.readOnlyReason(root, path); reason != "" {
+		fm.respondError(c, http.StatusForbidden, reason)
+		return
+	}
+
+	// 在读取请求体之前按目标位置限制大小，超出时不会把整个请求体读入内存或临时文件
+	maxUploadSize := root.uploadLimit(path, fm.maxUploadSize)
+	if !fm.parseUploadForm(c, maxUploadSize) {
 		return
 	}
 
 	file, handler, err := c.Request.FormFile("file")
 	if err != nil {
-		c.String(http.StatusBadRequest, "获取上传文件失败: %v", err)
+		fm.respondError(c, http.StatusBadRequest, "upload.no_file", err)
 		return
 	}
 	defer file.Close()
+	if handler.Size > maxUploadSize {
+		fm.respondError(c, http.StatusRequestEntityTooLarge, "upload.too_large", formatFileSize(maxUploadSize))
+		return
+	}
 
-	newFilePath := filepath.Join(path, handler.Filename)
-	if !user.IsPathAllowed(newFilePath) {
-		c.String(http.StatusForbidden, "没有权限上传文件到该位置")
+	newFilePath, err := root.resolve(path + "/" + handler.Filename)
+	if err != nil || !user.IsPathAllowed(newFilePath) {
+		fm.respondError(c, http.StatusForbidden, "perm.upload_path_denied")
 		return
 	}
 
-	dstPath := filepath.Join(targetDir, handler.Filename)
-	dst, err := os.Create(dstPath)
+	dst, err := root.Create(newFilePath)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "创建文件失败: %v", err)
+		fm.respondError(c, http.StatusInternalServerError, "upload.create_failed", err)
 		return
 	}
 	defer dst.Close()
 
 	if _, err = io.Copy(dst, file); err != nil {
-		c.String(http.StatusInternalServerError, "保存文件失败: %v", err)
+		fm.respondError(c, http.StatusInternalServerError, "upload.save_failed", err)
 		return
 	}
 
@@ -372,7 +555,7 @@ func (fm *FileManager) handleFileUpload(c *gin.Context) {
 
 // 文件编辑
 func (fm *FileManager) handleFileEditor(c *gin.Context) {
-	path := c.Query("path")
+	path := requestPath(c)
 	params := url.Values{}
 	params.Add("path", path)
 	params.Add("edit", "true")
@@ -382,16 +565,27 @@ func (fm *FileManager) handleFileEditor(c *gin.Context) {
 // 处理其他文件操作（编辑、新增、删除、重命名）
 func (fm *FileManager) handleFileAction(c *gin.Context) {
 	action := c.PostForm("action")
-	path := c.PostForm("path")
-	fullPath := filepath.Join(fm.rootDir, path)
+	path := requestPath(c)
+	root := fm.requestFiles(c)
 
 	user, exists := c.Get("user")
 	if !exists {
-		user = fm.guestUser
+		user = fm.guest()
 	}
 	currentUser := user.(User)
 
-	fileInfo, err := os.Stat(fullPath)
+	// 删除和重命名作用于路径本身，路径是符号链接时只处理链接，不跟随到链接目标
+	stat := root.Stat
+	if action == "delete" || action == "rename" {
+		entry, entryErr := root.resolveEntry(rawRequestPath(c))
+		if entryErr != nil || !currentUser.IsPathAllowed(entry) {
+			fm.respondError(c, http.StatusForbidden, "perm.path_denied")
+			return
+		}
+		path, stat = entry, root.Lstat
+	}
+
+	fileInfo, err := stat(path)
 	isDir := false
 	pathExists := true
 
@@ -399,146 +593,193 @@ func (fm *FileManager) handleFileAction(c *gin.Context) {
 		if os.IsNotExist(err) {
 			pathExists = false
 		} else {
-			c.String(http.StatusInternalServerError, "获取文件信息失败: %v", err)
+			fm.respondError(c, http.StatusInternalServerError, "file.stat_failed", err)
 			return
 		}
 	} else {
 		isDir = fileInfo.IsDir()
 	}
 
-	if action == "create" {
-		name := c.PostForm("name")
-		if isDirCreate := c.PostForm("is_dir"); isDirCreate == "true" {
-			newPath := filepath.Join(path, name)
-
-			if !currentUser.IsPathAllowed(newPath) {
-				c.String(http.StatusForbidden, "没有权限在该位置创建内容")
-				return
-			}
+	// 新建和重命名的目标路径同样经过解析
+	var newPath string
+	var newPathErr error
+	switch action {
+	case "create":
+		newPath, newPathErr = root.resolve(path + "/" + c.PostForm("name"))
+		if newPathErr != nil || !currentUser.IsPathAllowed(newPath) {
+			fm.respondError(c, http.StatusForbidden, "perm.create_path_denied")
+			return
 		}
+	case "rename":
+		newPath, newPathErr = root.resolveEntry(parentDir(path) + "/" + c.PostForm("new_name"))
+	}
+
+	// 只读模式和只读的挂载点不能修改，管理员同样受限；删除和重命名同时修改所在目录，挂载点本身不能删除或重命名
+	var readOnly string
+	switch action {
+	case "edit", "create":
+		readOnly = fm.readOnlyReason(root, path)
+	case "delete", "rename":
+		readOnly = fm.readOnlyReason(root, path, parentDir(path))
+	}
+	if readOnly != "" {
+		fm.respondError(c, http.StatusForbidden, readOnly)
+		return
 	}
 
 	switch action {
 	case "edit":
 		if !pathExists {
-			c.String(http.StatusNotFound, "文件不存在")
+			fm.respondError(c, http.StatusNotFound, "file.not_found")
 			return
 		}
 		if isDir {
-			c.String(http.StatusBadRequest, "不能编辑目录")
+			fm.respondError(c, http.StatusBadRequest, "edit.is_dir")
 			return
 		}
-		if !currentUser.HasPermission(PermissionFileEdit) {
-			c.String(http.StatusForbidden, "没有文件编辑权限")
+		if !currentUser.Can(PermissionFileEdit, path) {
+			fm.respondError(c, http.StatusForbidden, "perm.file_edit")
 			return
 		}
 	case "create":
 		name := c.PostForm("name")
 		if name == "" {
-			c.String(http.StatusBadRequest, "名称不能为空")
+			fm.respondError(c, http.StatusBadRequest, "create.empty_name")
 			return
 		}
 
 		isDirCreate := c.PostForm("is_dir") == "true"
 		if isDirCreate {
-			if !currentUser.HasPermission(PermissionDirCreate) {
-				c.String(http.StatusForbidden, "没有目录创建权限")
+			if !currentUser.Can(PermissionDirCreate, path) {
+				fm.respondError(c, http.StatusForbidden, "perm.dir_create")
 				return
 			}
 		} else {
 			// 创建文件需要目录的上传权限
-			if !currentUser.HasPermission(PermissionDirUpload) {
-				c.String(http.StatusForbidden, "没有文件创建权限")
+			if !currentUser.Can(PermissionDirUpload, path) {
+				fm.respondError(c, http.StatusForbidden, "perm.file_create")
 				return
 			}
 		}
 	case "delete":
 		if !pathExists {
-			c.String(http.StatusNotFound, "路径不存在")
+			fm.respondError(c, http.StatusNotFound, "file.path_not_found")
 			return
 		}
 
 		if isDir {
-			if !currentUser.HasPermission(PermissionDirDelete) {
-				c.String(http.StatusForbidden, "没有目录删除权限")
+			if !currentUser.Can(PermissionDirDelete, path) {
+				fm.respondError(c, http.StatusForbidden, "perm.dir_delete")
 				return
 			}
 		} else {
-			if !currentUser.HasPermission(PermissionFileDelete) {
-				c.String(http.StatusForbidden, "没有文件删除权限")
+			if !currentUser.Can(PermissionFileDelete, path) {
+				fm.respondError(c, http.StatusForbidden, "perm.file_delete")
 				return
 			}
 		}
 	case "rename":
 		if !pathExists {
-			c.String(http.StatusNotFound, "路径不存在")
+			fm.respondError(c, http.StatusNotFound, "file.path_not_found")
 			return
 		}
 
 		newName := c.PostForm("new_name")
 		if newName == "" {
-			c.String(http.StatusBadRequest, "新名称不能为空")
+			fm.respondError(c, http.StatusBadRequest, "rename.empty_name")
 			return
 		}
 
 		// 检查重命名后的路径是否允许访问
-		parentDir := filepath.Dir(path)
-		newPath := filepath.Join(parentDir, newName)
-		if !currentUser.IsPathAllowed(newPath) {
-			c.String(http.StatusForbidden, "没有权限使用该名称或路径")
+		if newPathErr != nil || !currentUser.IsPathAllowed(newPath) {
+			fm.respondError(c, http.StatusForbidden, "perm.rename_path_denied")
 			return
 		}
 
 		if isDir {
-			if !currentUser.HasPermission(PermissionDirRename) {
-				c.String(http.StatusForbidden, "没有目录重命名权限")
+			if !currentUser.Can(PermissionDirRename, path) {
+				fm.respondError(c, http.StatusForbidden, "perm.dir_rename")
 				return
 			}
 		} else {
-			if !currentUser.HasPermission(PermissionFileRename) {
-				c.String(http.StatusForbidden, "没有文件重命名权限")
+			if !currentUser.Can(PermissionFileRename, path) {
+				fm.respondError(c, http.StatusForbidden, "perm.file_rename")
+				return
+			}
+		}
+
+		// new_name 包含 ../ 等路径时会移动到其他目录，目标目录还需要创建目录或上传文件的权限
+		if targetDir := parentDir(newPath); targetDir != parentDir(path) {
+			permission := PermissionDirUpload
+			if isDir {
+				permission = PermissionDirCreate
+			}
+			if !currentUser.Can(permission, targetDir) {
+				fm.respondError(c, http.StatusForbidden, "perm.rename_path_denied")
 				return
 			}
 		}
 	default:
-		c.String(http.StatusBadRequest, "未知操作")
+		fm.respondError(c, http.StatusBadRequest, "action.unknown")
 		return
 	}
 
 	switch action {
 	case "edit":
 		content := c.PostForm("content")
+		encodingName := c.PostForm("encoding")
+		lineEnding := c.PostForm("line_ending")
+
+		// 未指定编码或换行符时沿用原文件的设置
+		if encodingName == "" || lineEnding == "" {
+			original := &textContent{Encoding: EncodingUTF8, LineEnding: LineEndingLF}
+			if data, readErr := root.ReadFile(path); readErr == nil {
+				if decoded, decodeErr := decodeText(data); decodeErr == nil {
+					original = decoded
+				}
+			}
+			if encodingName == "" {
+				encodingName = original.Encoding
+			}
+			if lineEnding == "" {
+				lineEnding = original.LineEnding
+			}
+		}
+
+		data, encodeErr := encodeText(content, encodingName, lineEnding)
+		if encodeErr != nil {
+			fm.respondError(c, http.StatusBadRequest, "edit.failed", encodeErr)
+			return
+		}
 
 		// 在保存新内容前创建备份
-		if err = createFileBackup(fullPath); err != nil {
-			c.String(http.StatusInternalServerError, "创建文件备份失败: %v", err)
+		if err = createFileBackup(root, path); err != nil {
+			fm.respondError(c, http.StatusInternalServerError, "edit.backup_failed", err)
 			return
 		}
 
 		// 保存新内容
-		if err = os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-			c.String(http.StatusInternalServerError, "编辑文件失败: %v", err)
+		if err = root.WriteFile(path, data, 0644); err != nil {
+			fm.respondError(c, http.StatusInternalServerError, "edit.failed", err)
 			return
 		}
 	case "create":
-		name := c.PostForm("name")
-		isDirCreate := c.PostForm("is_dir") == "true"
-		newPath := filepath.Join(fullPath, name)
-
-		if isDirCreate {
-			if err = os.MkdirAll(newPath, 0755); err != nil {
-				c.String(http.StatusInternalServerError, "创建目录失败: %v", err)
+		if c.PostForm("is_dir") == "true" {
+			if err = root.MkdirAll(newPath, 0755); err != nil {
+				fm.respondError(c, http.StatusInternalServerError, "create.dir_failed", err)
 				return
 			}
 		} else {
-			if _, err = os.Create(newPath); err != nil {
-				c.String(http.StatusInternalServerError, "创建文件失败: %v", err)
+			var file *os.File
+			if file, err = root.Create(newPath); err != nil {
+				fm.respondError(c, http.StatusInternalServerError, "create.file_failed", err)
 				return
 			}
+			file.Close()
 		}
 	case "delete":
-		if err = os.RemoveAll(fullPath); err != nil {
-			c.String(http.StatusInternalServerError, "删除失败: %v", err)
+		if err = root.RemoveAll(path); err != nil {
+			fm.respondError(c, http.StatusInternalServerError, "delete.failed", err)
 			return
 		}
 		// 删除后返回父目录
@@ -548,20 +789,15 @@ func (fm *FileManager) handleFileAction(c *gin.Context) {
 		}
 		path = parentPath
 	case "rename":
-		newName := c.PostForm("new_name")
-		// 获取父目录和旧名称
-		parentDir := filepath.Dir(fullPath)
-		newPath := filepath.Join(parentDir, newName)
-
-		// 检查新名称是否已存在
-		if _, err = os.Stat(newPath); err == nil {
-			c.String(http.StatusBadRequest, "名称已存在: %s", newName)
+		// 检查新名称是否已存在，包括失效的符号链接
+		if _, err = root.Lstat(newPath); err == nil {
+			fm.respondError(c, http.StatusBadRequest, "rename.exists", c.PostForm("new_name"))
 			return
 		}
 
 		// 执行重命名
-		if err = os.Rename(fullPath, newPath); err != nil {
-			c.String(http.StatusInternalServerError, "重命名失败: %v", err)
+		if err = root.Rename(path, newPath); err != nil {
+			fm.respondError(c, http.StatusInternalServerError, "rename.failed", err)
 			return
 		}
 
@@ -579,30 +815,27 @@ func (fm *FileManager) handleFileAction(c *gin.Context) {
 }
 
 // 创建文件备份
-func createFileBackup(filePath string) error {
+func createFileBackup(files *rootFS, filePath string) error {
 	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("文件不存在")
+	if _, err := files.Stat(filePath); os.IsNotExist(err) {
+		return newMessageError("file.not_found")
 	}
 
 	// 获取当前时间戳
 	timestamp := time.Now().Format("20060102150405.000000")
 
 	// 构建备份文件名：原文件名_时间戳
-	dir := filepath.Dir(filePath)
-	filename := filepath.Base(filePath)
-	backupFilename := fmt.Sprintf("%s_%s", filename, timestamp)
-	backupPath := filepath.Join(dir, backupFilename)
+	backupPath := fmt.Sprintf("%s_%s", filePath, timestamp)
 
 	// 打开源文件
-	sourceFile, err := os.Open(filePath)
+	sourceFile, err := files.Open(filePath)
 	if err != nil {
 		return err
 	}
 	defer sourceFile.Close()
 
 	// 创建备份文件
-	destFile, err := os.Create(backupPath)
+	destFile, err := files.Create(backupPath)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,133 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ACLRule 在路径及其子路径上授予或拒绝权限，优先于用户和角色的全局权限
+//
+// 判断某个权限时，只看路径匹配且 allow 或 deny 中包含该权限的规则：
+//  1. 管理员不受规则限制
+//  2. 路径最具体的规则生效，即规则中不含通配符的路径段最多，** 和 * 等通配段不计入，同样具体时 deny 优先
+//     例如 /projects/*/public 比 /projects 具体，/**/secret 与 /projects 同样具体
+//  3. 没有规则涉及该权限时使用全局权限
+//
+// 规则只决定操作权限，路径能否看到仍由 path_restrictions 和 path_blocking 决定
+type ACLRule struct {
+	Path  string   `json:"path"            yaml:"path"            toml:"path"`
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty" toml:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"  yaml:"deny,omitempty"  toml:"deny,omitempty"`
+}
+
+// 校验路径规则
+func validateACL(field string, rules []ACLRule) []error {
+	var errs []error
+	for i, rule := range rules {
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		if strings.TrimSpace(rule.Path) == "" {
+			errs = append(errs, fmt.Errorf("%s.path: 不能为空", itemField))
+		} else if strings.HasPrefix(strings.TrimSpace(rule.Path), "!") {
+			errs = append(errs, fmt.Errorf("%s.path: 不支持 ! 排除规则，使用 deny", itemField))
+		} else if err := validatePathPattern(rule.Path); err != nil {
+			errs = append(errs, fmt.Errorf("%s.path: %q 无法编译: %v", itemField, rule.Path, err))
+		}
+		if len(rule.Allow) == 0 && len(rule.Deny) == 0 {
+			errs = append(errs, fmt.Errorf("%s: allow 和 deny 不能同时为空", itemField))
+		}
+		for _, permission := range slices.Concat(rule.Allow, rule.Deny) {
+			if !IsValidPermission(permission) {
+				errs = append(errs, fmt.Errorf("%s: 未知权限 %q", itemField, permission))
+			}
+		}
+	}
+	return errs
+}
+
+// 两条规则相同
+func (r ACLRule) equal(other ACLRule) bool {
+	return r.Path == other.Path && slices.Equal(r.Allow, other.Allow) && slices.Equal(r.Deny, other.Deny)
+}
+
+// aclRule 编译了路径的 ACLRule，由 roleRegistry.resolve 生成
+type aclRule struct {
+	ACLRule
+	pattern *pathPattern
+}
+
+// 编译规则路径，任一规则无法编译或使用 ! 时返回错误
+func compileACL(rules []ACLRule) ([]aclRule, error) {
+	compiled := make([]aclRule, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := compilePathPattern(rule.Path)
+		if err != nil {
+			return nil, fmt.Errorf("acl 路径 %q 无效: %v", rule.Path, err)
+		}
+		if pattern.negate {
+			return nil, fmt.Errorf("acl 路径 %q 不支持 ! 排除规则", rule.Path)
+		}
+		compiled = append(compiled, aclRule{ACLRule: rule, pattern: pattern})
+	}
+	return compiled, nil
+}
+
+// 路径被规则路径匹配，语法与 path_restrictions 相同，/configs/dev 不匹配 /configs/development
+func (r aclRule) matches(path string) bool {
+	return r.pattern.match(splitPath(path))
+}
+
+// 按路径规则判断权限，没有规则涉及该权限时使用全局权限，挂载点的默认权限只能拒绝，不会授予用户没有的全局权限
+func (e *effectivePermissions) allows(permission, path string) bool {
+	if allowed, decided := decideACL(e.acl, permission, path); decided {
+		return allowed
+	}
+	if allowed, decided := decideACL(e.defaults, permission, path); decided && !allowed {
+		return false
+	}
+	return e.permissions[permission]
+}
+
+// 路径最具体(不含通配符的段最多)的规则决定结果，decided 为 false 表示没有规则涉及该权限
+func decideACL(rules []aclRule, permission, path string) (allowed, decided bool) {
+	specificity := -1
+	for _, rule := range rules {
+		deny := slices.Contains(rule.Deny, permission)
+		if (!deny && !slices.Contains(rule.Allow, permission)) || !rule.matches(path) {
+			continue
+		}
+		current := rule.pattern.literals
+		switch {
+		case current > specificity:
+			decided, allowed, specificity = true, !deny, current
+		case current == specificity && deny:
+			allowed = false
+		}
+	}
+	return allowed, decided
+}
+
+// Can 判断用户能否在该路径上使用权限，合并全局权限和路径规则，不检查路径本身是否可见，
+// 路径相对用户可见的根目录，有家目录时按相对根目录的路径匹配规则
+func (u *User) Can(permission, path string) bool {
+	effective := u.effective()
+	if effective.limit != nil && !effective.limit[permission] {
+		return false
+	}
+	return effective.admin || (effective.err == nil && effective.allows(permission, effective.absPath(path)))
+}
+
+// 全局拥有或在某个路径规则中被授予的权限，用于 API token 可选的权限
+func (u *User) hasPermissionAnywhere(permission string) bool {
+	if u.HasPermission(permission) {
+		return true
+	}
+	effective := u.effective()
+	if effective.limit != nil && !effective.limit[permission] {
+		return false
+	}
+	return slices.ContainsFunc(effective.acl, func(rule aclRule) bool {
+		return slices.Contains(rule.Allow, permission)
+	})
+}
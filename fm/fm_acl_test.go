@@ -0,0 +1,161 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 不含通配符的路径段多的规则优先，通配段不因为规则文本更长而更具体，同样具体时 deny 优先
+func TestDecideACLSpecificity(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []ACLRule
+		path    string
+		allowed bool
+		decided bool
+	}{
+		{"deeper literal wins", []ACLRule{
+			{Path: "/projects", Deny: []string{PermissionFileEdit}},
+			{Path: "/projects/web", Allow: []string{PermissionFileEdit}},
+		}, "/projects/web/a.txt", true, true},
+		{"glob is not more specific", []ACLRule{
+			{Path: "/projects", Deny: []string{PermissionFileEdit}},
+			{Path: "/*/?????.txt", Allow: []string{PermissionFileEdit}},
+		}, "/projects/a.txt", false, true},
+		{"literal beats long glob", []ACLRule{
+			{Path: "/**/[a-z][a-z][a-z]", Deny: []string{PermissionFileEdit}},
+			{Path: "/projects/web", Allow: []string{PermissionFileEdit}},
+		}, "/projects/web", true, true},
+		{"wildcard segment between literals", []ACLRule{
+			{Path: "/projects", Deny: []string{PermissionFileEdit}},
+			{Path: "/projects/*/public", Allow: []string{PermissionFileEdit}},
+		}, "/projects/web/public", true, true},
+		{"tie prefers deny", []ACLRule{
+			{Path: "/projects/web", Allow: []string{PermissionFileEdit}},
+			{Path: "/**/projects/web", Deny: []string{PermissionFileEdit}},
+		}, "/projects/web", false, true},
+		{"escaped wildcard is literal", []ACLRule{
+			{Path: "/projects", Deny: []string{PermissionFileEdit}},
+			{Path: `/projects/\*`, Allow: []string{PermissionFileEdit}},
+		}, "/projects/*", true, true},
+		{"other permission", []ACLRule{
+			{Path: "/projects", Deny: []string{PermissionFileDelete}},
+		}, "/projects", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileACL(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			allowed, decided := decideACL(rules, PermissionFileEdit, tt.path)
+			if allowed != tt.allowed || decided != tt.decided {
+				t.Errorf("decideACL = %v, %v, want %v, %v", allowed, decided, tt.allowed, tt.decided)
+			}
+		})
+	}
+}
+
+// new_name 通过 ../ 移动到其他目录时检查目标目录的上传权限
+func TestRenameChecksTargetDir(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	for _, d := range []string{"work", "locked"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "work", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fm := NewFileManager(dir, zap.NewNop()).SetUsers(map[string]User{
+		"alice": {
+			Username:                 "alice",
+			EncryptPassword:          DefaultHashPassword("secret"),
+			Permissions:              map[string]bool{PermissionDirView: true, PermissionFileView: true, PermissionFileRename: true, PermissionDirUpload: true},
+			BaseRolePathRestrictions: []string{"/"},
+			ACL:                      []ACLRule{{Path: "/locked", Deny: []string{PermissionDirUpload}}},
+		},
+	})
+	engine := fm.engine()
+	cookies := testLogin(t, engine, "alice", "secret")
+	rename := func(path, newName string) int {
+		values := url.Values{"action": {"rename"}, "path": {path}, "new_name": {newName}}
+		request := httptest.NewRequest(http.MethodPost, "/file/action", strings.NewReader(values.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	if code := rename("work/a.txt", "../locked/a.txt"); code != http.StatusForbidden {
+		t.Fatalf("move into locked = %d, want 403", code)
+	}
+	assertExists(t, filepath.Join(dir, "work", "a.txt"))
+
+	if code := rename("work/a.txt", "b.txt"); code != http.StatusSeeOther {
+		t.Fatalf("rename in place = %d, want 303", code)
+	}
+	if code := rename("work/b.txt", "../b.txt"); code != http.StatusSeeOther {
+		t.Fatalf("move to root = %d, want 303", code)
+	}
+	assertExists(t, filepath.Join(dir, "b.txt"))
+}
+
+// 路径规则拒绝 file:view 或 file:edit 时，直接访问 /file?path= 同样被拒绝
+func TestFilePageChecksACL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	for _, name := range []string{"public.txt", "secret.txt", "readonly.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("content of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fm := NewFileManager(dir, zap.NewNop()).SetUsers(map[string]User{
+		"alice": {
+			Username:                 "alice",
+			EncryptPassword:          DefaultHashPassword("secret"),
+			Permissions:              map[string]bool{PermissionDirView: true, PermissionFileView: true, PermissionFileEdit: true},
+			BaseRolePathRestrictions: []string{"/"},
+			ACL: []ACLRule{
+				{Path: "/secret.txt", Deny: []string{PermissionFileView, PermissionFileEdit}},
+				{Path: "/readonly.txt", Deny: []string{PermissionFileEdit}},
+			},
+		},
+	})
+	engine := fm.engine()
+	cookies := testLogin(t, engine, "alice", "secret")
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/file?path=public.txt", http.StatusOK},
+		{"/file?path=public.txt&edit=true", http.StatusOK},
+		{"/file?path=secret.txt", http.StatusForbidden},
+		{"/file?path=secret.txt&edit=true", http.StatusForbidden},
+		{"/file?path=readonly.txt", http.StatusOK},
+		{"/file?path=readonly.txt&edit=true", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		recorder := serveTest(engine, http.MethodGet, tt.target, cookies)
+		if recorder.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.target, recorder.Code, tt.status)
+		}
+		if tt.status == http.StatusForbidden && strings.Contains(recorder.Body.String(), "content of") {
+			t.Errorf("GET %s leaked the file content", tt.target)
+		}
+	}
+}
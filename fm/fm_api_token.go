@@ -0,0 +1,328 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API token 以固定前缀开头，便于与会话 JWT 区分，也便于在代码仓库中扫描泄露的 token
+const apiTokenPrefix = "fmpat_"
+
+// 创建 API token 时可选的有效期(天)，0 表示永不过期
+var apiTokenExpiryDays = []int{7, 30, 90, 365, 0}
+
+// API token 页面的错误码
+const (
+	apiTokenErrorName        = "name"
+	apiTokenErrorPermissions = "permissions"
+	apiTokenErrorPath        = "path"
+	apiTokenErrorExpiry      = "expiry"
+	apiTokenErrorUnsupported = "unsupported"
+	apiTokenErrorFailed      = "failed"
+)
+
+var apiTokenErrorMessages = map[string]string{
+	apiTokenErrorName:        "token.error.name",
+	apiTokenErrorPermissions: "token.error.permissions",
+	apiTokenErrorPath:        "token.error.path",
+	apiTokenErrorExpiry:      "token.error.expiry",
+	apiTokenErrorUnsupported: "token.error.unsupported",
+	apiTokenErrorFailed:      "token.error.failed",
+}
+
+// APIToken 用户创建的个人 API token，只保存 token 的 SHA-256，权限和路径只能在用户自身权限的范围内收窄
+type APIToken struct {
+	ID               string    `json:"id"                          yaml:"id"                          toml:"id"`
+	Name             string    `json:"name"                        yaml:"name"                        toml:"name"`
+	Hash             string    `json:"hash"                        yaml:"hash"                        toml:"hash"`
+	Permissions      []string  `json:"permissions,omitempty"       yaml:"permissions,omitempty"       toml:"permissions,omitempty"`
+	PathRestrictions []string  `json:"path_restrictions,omitempty" yaml:"path_restrictions,omitempty" toml:"path_restrictions,omitempty"` // 为空时使用用户自身的路径限制
+	CreatedAt        time.Time `json:"created_at"                  yaml:"created_at"                  toml:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at,omitzero"         yaml:"expires_at,omitempty"        toml:"expires_at,omitempty"` // 零值表示永不过期
+}
+
+// Expired 判断 token 是否已过期
+func (t APIToken) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt)
+}
+
+// 校验用户的 API token
+func validateAPITokens(field string, tokens []APIToken) []error {
+	var errs []error
+	ids := map[string]bool{}
+	for i, token := range tokens {
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		if token.ID == "" || ids[token.ID] {
+			errs = append(errs, fmt.Errorf("%s.id: 不能为空且不能重复", itemField))
+		}
+		ids[token.ID] = true
+		if token.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name: 不能为空", itemField))
+		}
+		if !isRecoveryCodeHash(token.Hash) {
+			errs = append(errs, fmt.Errorf("%s.hash: %q 不是 SHA-256", itemField, token.Hash))
+		}
+		uc := UserConfig{Permissions: token.Permissions, PathRestrictions: token.PathRestrictions}
+		errs = append(errs, uc.validate(itemField)...)
+	}
+	return errs
+}
+
+// 生成 token，格式为 fmpat_<base64url(用户名)>.<随机值>，用户名用于定位用户，随机值保证不可猜测
+func generateAPIToken(username string) string {
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(username)) + "." + strings.ToLower(rand.Text())
+}
+
+func hashAPIToken(token string) string {
+	return sha256Hex(token)
+}
+
+// 解析 token 中的用户名
+func apiTokenUsername(token string) (string, bool) {
+	encoded, _, ok := strings.Cut(strings.TrimPrefix(token, apiTokenPrefix), ".")
+	if !ok {
+		return "", false
+	}
+	username, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(username) == 0 {
+		return "", false
+	}
+	return string(username), true
+}
+
+// 按 token 收窄用户合并角色后的权限，管理员角色不会传递给 token，用户的路径规则仍然生效
+func (t APIToken) scope(user User) User {
+	effective := user.effective()
+	scoped := user
+	scoped.Role, scoped.Roles, scoped.Groups = "", nil, nil
+	limit := make(map[string]bool, len(t.Permissions))
+	for _, permission := range t.Permissions {
+		limit[permission] = true
+	}
+	if effective.admin {
+		// 管理员不受路径限制，token 未限定路径时同样可以访问所有路径
+		restrictions := []string{"/"}
+		if len(t.PathRestrictions) > 0 {
+			restrictions = t.PathRestrictions
+		}
+		scoped.resolved = &effectivePermissions{permissions: limit, limit: limit}
+		scoped.resolved.restrictions, scoped.resolved.err = compilePathPatterns(restrictions)
+		scoped.Home = "/"
+	} else {
+		tokenRestrictions, err := compilePathPatterns(t.PathRestrictions)
+		scoped.resolved = &effectivePermissions{
+			permissions:       effective.permissions,
+			restrictions:      effective.restrictions,
+			blocking:          effective.blocking,
+			tokenRestrictions: tokenRestrictions,
+			acl:               effective.acl,
+			defaults:          effective.defaults,
+			limit:             limit,
+			err:               errors.Join(effective.err, err),
+			home:              effective.home,
+		}
+		scoped.TokenPathRestrictions = t.PathRestrictions
+	}
+	return scoped
+}
+
+// 校验 API token 并返回收窄权限后的用户
+func (fm *FileManager) authenticateAPIToken(token string) (User, APIToken, error) {
+	username, ok := apiTokenUsername(token)
+	if !ok {
+		return User{}, APIToken{}, errors.New("token 格式错误")
+	}
+	user, exists := fm.lookupUser(username)
+	if !exists {
+		return User{}, APIToken{}, ErrUserNotFound
+	}
+
+	hash := hashAPIToken(token)
+	index := slices.IndexFunc(user.APITokens, func(stored APIToken) bool {
+		return subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(hash)) == 1
+	})
+	if index < 0 {
+		return User{}, APIToken{}, errors.New("token 不存在或已撤销")
+	}
+	apiToken := user.APITokens[index]
+	if apiToken.Expired(time.Now()) {
+		return User{}, APIToken{}, fmt.Errorf("token %s 已于 %s 过期", apiToken.Name, apiToken.ExpiresAt.Format(time.DateTime))
+	}
+	scoped := apiToken.scope(user)
+	if err := scoped.resolved.err; err != nil {
+		return User{}, APIToken{}, fmt.Errorf("token %s 的路径规则无效: %w", apiToken.Name, err)
+	}
+	return scoped, apiToken, nil
+}
+
+// API token 列表中的一项
+type apiTokenEntry struct {
+	ID               string
+	Name             string
+	Permissions      string
+	PathRestrictions string
+	CreatedAt        string
+	ExpiresAt        string
+	Expired          bool
+}
+
+// 可选的权限和有效期
+type apiTokenOption struct {
+	Value string
+	Label string
+}
+
+// 列出用户的 API token 和创建表单
+func (fm *FileManager) showAPITokens(c *gin.Context) {
+	user, ok := fm.currentUser(c)
+	if !ok {
+		c.Redirect(http.StatusSeeOther, "/file/login")
+		return
+	}
+	fm.renderAPITokens(c, user, "")
+}
+
+func (fm *FileManager) renderAPITokens(c *gin.Context, user User, created string) {
+	data := apiTokenPageData{
+		pageData: fm.newPageData(c, user),
+		Created:  created,
+	}
+	if key, ok := apiTokenErrorMessages[c.Query("error")]; ok {
+		data.Error = fm.t(c, key)
+	}
+
+	now := time.Now()
+	never := fm.t(c, "token.never")
+	for _, token := range user.APITokens {
+		entry := apiTokenEntry{
+			ID:               token.ID,
+			Name:             token.Name,
+			Permissions:      strings.Join(token.Permissions, ", "),
+			PathRestrictions: strings.Join(token.PathRestrictions, ", "),
+			CreatedAt:        token.CreatedAt.Local().Format(time.DateTime),
+			ExpiresAt:        never,
+			Expired:          token.Expired(now),
+		}
+		if !token.ExpiresAt.IsZero() {
+			entry.ExpiresAt = token.ExpiresAt.Local().Format(time.DateTime)
+		}
+		data.Tokens = append(data.Tokens, entry)
+	}
+	for _, permission := range AllPermissions {
+		if user.hasPermissionAnywhere(permission) {
+			data.Permissions = append(data.Permissions, apiTokenOption{Value: permission, Label: permission})
+		}
+	}
+	for _, days := range apiTokenExpiryDays {
+		label := never
+		if days > 0 {
+			label = fm.t(c, "token.days", days)
+		}
+		data.Expiries = append(data.Expiries, apiTokenOption{Value: strconv.Itoa(days), Label: label})
+	}
+	fm.renderHTML(c, http.StatusOK, templateAPITokens, data)
+}
+
+// 创建 API token，明文只在创建后显示一次
+func (fm *FileManager) handleAPITokenCreate(c *gin.Context) {
+	user, ok := fm.storedUser(c, "/file/settings/tokens?error="+apiTokenErrorUnsupported)
+	if !ok {
+		return
+	}
+	fail := func(code string) {
+		c.Redirect(http.StatusSeeOther, "/file/settings/tokens?error="+code)
+	}
+
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" || slices.ContainsFunc(user.APITokens, func(t APIToken) bool { return t.Name == name }) {
+		fail(apiTokenErrorName)
+		return
+	}
+	permissions := c.PostFormArray("permissions")
+	if len(permissions) == 0 {
+		fail(apiTokenErrorPermissions)
+		return
+	}
+	for _, permission := range permissions {
+		if !IsValidPermission(permission) || !user.hasPermissionAnywhere(permission) {
+			fail(apiTokenErrorPermissions)
+			return
+		}
+	}
+	var paths []string
+	for _, line := range strings.Split(c.PostForm("path_restrictions"), "\n") {
+		if path := strings.TrimSpace(line); path != "" {
+			if validatePathPattern(path) != nil {
+				fail(apiTokenErrorPath)
+				return
+			}
+			paths = append(paths, path)
+		}
+	}
+	days, err := strconv.Atoi(c.PostForm("expires_days"))
+	if err != nil || !slices.Contains(apiTokenExpiryDays, days) {
+		fail(apiTokenErrorExpiry)
+		return
+	}
+
+	plain := generateAPIToken(user.Username)
+	token := APIToken{
+		ID:               strings.ToLower(rand.Text()[:10]),
+		Name:             name,
+		Hash:             hashAPIToken(plain),
+		Permissions:      permissions,
+		PathRestrictions: paths,
+		CreatedAt:        time.Now().UTC().Truncate(time.Second),
+	}
+	if days > 0 {
+		token.ExpiresAt = token.CreatedAt.AddDate(0, 0, days)
+	}
+	user.APITokens = append(slices.Clone(user.APITokens), token)
+	if err = fm.userStore.Update(user); errors.Is(err, ErrUserReadOnly) {
+		fail(apiTokenErrorUnsupported)
+		return
+	} else if err != nil {
+		fm.log.Errorf("保存用户 %s 的 API token 失败: %v", user.Username, err)
+		fail(apiTokenErrorFailed)
+		return
+	}
+	fm.audit(c, AuditAPITokenCreated, "username", user.Username, "token_id", token.ID, "token_name", token.Name)
+	fm.renderAPITokens(c, user, plain)
+}
+
+// 撤销 API token，立即生效
+func (fm *FileManager) handleAPITokenRevoke(c *gin.Context) {
+	user, ok := fm.storedUser(c, "/file/settings/tokens?error="+apiTokenErrorUnsupported)
+	if !ok {
+		return
+	}
+	id := c.PostForm("id")
+	index := slices.IndexFunc(user.APITokens, func(t APIToken) bool { return t.ID == id })
+	if index < 0 {
+		c.Redirect(http.StatusSeeOther, "/file/settings/tokens")
+		return
+	}
+	token := user.APITokens[index]
+	user.APITokens = slices.Delete(slices.Clone(user.APITokens), index, index+1)
+	if err := fm.userStore.Update(user); errors.Is(err, ErrUserReadOnly) {
+		c.Redirect(http.StatusSeeOther, "/file/settings/tokens?error="+apiTokenErrorUnsupported)
+		return
+	} else if err != nil {
+		fm.log.Errorf("撤销用户 %s 的 API token 失败: %v", user.Username, err)
+		c.Redirect(http.StatusSeeOther, "/file/settings/tokens?error="+apiTokenErrorFailed)
+		return
+	}
+	fm.audit(c, AuditAPITokenRevoked, "username", user.Username, "token_id", token.ID, "token_name", token.Name)
+	c.Redirect(http.StatusSeeOther, "/file/settings/tokens")
+}
@@ -0,0 +1,75 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// token 只能在用户自身的权限和路径范围内收窄，过期或撤销的 token 无效
+func TestAPITokenScope(t *testing.T) {
+	now := time.Now().UTC()
+	plain := map[string]string{}
+	token := func(username, id string, permissions, paths []string, expiresAt time.Time) APIToken {
+		plain[id] = generateAPIToken(username)
+		return APIToken{ID: id, Name: id, Hash: hashAPIToken(plain[id]), Permissions: permissions, PathRestrictions: paths, CreatedAt: now, ExpiresAt: expiresAt}
+	}
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetUsers(map[string]User{
+		"alice": {
+			Username:                 "alice",
+			Permissions:              map[string]bool{PermissionDirView: true, PermissionFileView: true, PermissionFileDownload: true},
+			BaseRolePathRestrictions: []string{"/reports", "/shared"},
+			BaseRolePathBlocking:     []string{"/reports/private"},
+			APITokens: []APIToken{
+				token("alice", "reader", []string{PermissionDirView, PermissionFileView, PermissionFileDelete}, []string{"/reports"}, time.Time{}),
+				token("alice", "expired", []string{PermissionFileView}, nil, now.Add(-time.Hour)),
+			},
+		},
+		"admin": {
+			Username:  "admin",
+			Roles:     []string{RoleAdmin},
+			APITokens: []APIToken{token("admin", "backup", []string{PermissionFileDownload}, []string{"/backup"}, now.Add(time.Hour))},
+		},
+	})
+
+	tests := []struct {
+		token      string
+		permission string
+		path       string
+		want       bool
+	}{
+		{"reader", PermissionFileView, "/reports/a.csv", true},
+		{"reader", PermissionFileDownload, "/reports/a.csv", false},
+		{"reader", PermissionFileDelete, "/reports/a.csv", false},
+		{"reader", PermissionFileView, "/shared/a.csv", false},
+		{"reader", PermissionFileView, "/reports/private/a.csv", false},
+		{"backup", PermissionFileDownload, "/backup/db.sql", true},
+		{"backup", PermissionFileDownload, "/etc/passwd", false},
+		{"backup", PermissionFileDelete, "/backup/db.sql", false},
+	}
+	for _, tt := range tests {
+		user, _, err := fm.authenticateAPIToken(plain[tt.token])
+		if err != nil {
+			t.Fatalf("%s: %v", tt.token, err)
+		}
+		if user.IsAdmin() {
+			t.Errorf("%s: token is admin", tt.token)
+		}
+		if got := user.Can(tt.permission, tt.path) && user.IsPathAllowed(tt.path); got != tt.want {
+			t.Errorf("%s: %s on %s = %v, want %v", tt.token, tt.permission, tt.path, got, tt.want)
+		}
+	}
+
+	for name, value := range map[string]string{
+		"expired":      plain["expired"],
+		"unknown":      generateAPIToken("alice"),
+		"no such user": generateAPIToken("mallory"),
+		"malformed":    apiTokenPrefix + "!!",
+	} {
+		if _, _, err := fm.authenticateAPIToken(value); err == nil {
+			t.Errorf("%s token accepted", name)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计事件
+const (
+	AuditLoginSuccess = "login.success" // 登录成功
+	AuditLoginFailure = "login.failure" // 用户名或密码错误
+	AuditLoginLocked  = "login.locked"  // 失败次数过多，账户或 IP 被锁定
+	AuditLoginBlocked = "login.blocked" // 锁定或退避期间的登录请求被拒绝
+
+	AuditTOTPFailure        = "totp.failure"        // 两步验证码或恢复码错误
+	AuditTOTPEnabled        = "totp.enabled"        // 启用两步验证
+	AuditTOTPDisabled       = "totp.disabled"       // 关闭两步验证
+	AuditRecoveryCodesReset = "totp.recovery_reset" // 重新生成恢复码
+
+	AuditAPITokenCreated = "api_token.created" // 创建 API token
+	AuditAPITokenRevoked = "api_token.revoked" // 撤销 API token
+	AuditAPITokenInvalid = "api_token.invalid" // 使用了无效、已撤销或已过期的 API token
+
+	AuditLogout               = "logout"                // 退出登录
+	AuditSessionRevoked       = "session.revoked"       // 撤销单个会话
+	AuditSessionRevokedAll    = "session.revoked_all"   // 撤销用户的所有会话
+	AuditSessionRefreshReused = "session.refresh_reuse" // 已轮换的刷新 token 被再次使用，会话已撤销
+
+	AuditIPDenied     = "access.ip_denied"     // 客户端地址不在用户的 IP 白名单中
+	AuditPathRejected = "access.path_rejected" // 请求路径超出根目录或违反符号链接策略
+	AuditCrossOrigin  = "access.cross_origin"  // 修改状态的请求来自其他站点
+
+	AuditModeChanged = "admin.mode_changed" // 管理员切换只读或维护模式
+)
+
+// 记录审计事件，事件同时写入该请求的审计日志，成功类事件为 info 级别，其余为 warn 级别
+func (fm *FileManager) audit(c *gin.Context, event string, keysAndValues ...any) {
+	c.Set("auditEvent", event)
+	logger := fm.log.With(append([]any{"audit_event", event, "client_ip", c.ClientIP()}, keysAndValues...)...)
+	if strings.HasSuffix(event, ".success") {
+		logger.Info("audit")
+	} else {
+		logger.Warn("audit")
+	}
+}
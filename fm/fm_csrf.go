@@ -0,0 +1,42 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 校验修改状态的请求来自本站页面。会话 cookie 会随跨站表单提交一起发送，
+// 浏览器在 POST 请求中会带上 Origin 或 Referer，与请求的 Host 不一致时拒绝；
+// 使用 Authorization 请求头认证和两者都没有的请求不是浏览器跨站提交，直接放行
+func (fm *FileManager) sameOriginMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if c.GetHeader("Authorization") != "" {
+			c.Next()
+			return
+		}
+
+		source := c.GetHeader("Origin")
+		if source == "" {
+			source = c.GetHeader("Referer")
+		}
+		if source == "" {
+			c.Next()
+			return
+		}
+		if u, err := url.Parse(source); err != nil || u.Host != c.Request.Host {
+			fm.audit(c, AuditCrossOrigin, "origin", source)
+			fm.respondError(c, http.StatusForbidden, "perm.cross_origin")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 会话 cookie 使用 SameSite=Lax，来自其他站点的 POST 请求被拒绝且不会撤销会话
+func TestSameOriginPost(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetUsers(map[string]User{
+		"admin": {Username: "admin", EncryptPassword: DefaultHashPassword("secret"), Roles: []string{RoleAdmin}},
+	})
+	engine := fm.engine()
+	cookies := testLogin(t, engine, "admin", "secret")
+	for _, cookie := range cookies {
+		if cookie.MaxAge >= 0 && cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("cookie %s SameSite = %v, want Lax", cookie.Name, cookie.SameSite)
+		}
+	}
+
+	post := func(headers map[string]string) int {
+		request := httptest.NewRequest(http.MethodPost, "/file/logout/all", nil)
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"other origin", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"opaque origin", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"other referer", map[string]string{"Referer": "https://evil.example/form"}, http.StatusForbidden},
+		{"same origin", map[string]string{"Origin": "http://example.com"}, http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		if got := post(tt.headers); got != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.status)
+		}
+		if tt.status == http.StatusForbidden && len(fm.sessions.list("admin")) == 0 {
+			t.Fatalf("%s: sessions revoked by a cross-site request", tt.name)
+		}
+	}
+}
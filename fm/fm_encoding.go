@@ -0,0 +1,127 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// 文本编码
+const (
+	EncodingUTF8    = "UTF-8"
+	EncodingUTF8BOM = "UTF-8 BOM"
+	EncodingUTF16LE = "UTF-16LE"
+	EncodingUTF16BE = "UTF-16BE"
+	EncodingGBK     = "GBK"
+	EncodingGB18030 = "GB18030"
+)
+
+// 换行符风格
+const (
+	LineEndingLF   = "LF"
+	LineEndingCRLF = "CRLF"
+)
+
+// TextEncodings 支持的文本编码，按编辑页面的显示顺序排列
+var TextEncodings = []string{EncodingUTF8, EncodingUTF8BOM, EncodingUTF16LE, EncodingUTF16BE, EncodingGBK, EncodingGB18030}
+
+// LineEndings 支持的换行符风格
+var LineEndings = []string{LineEndingLF, LineEndingCRLF}
+
+var textEncodingMap = map[string]encoding.Encoding{
+	EncodingUTF8:    encoding.Nop,
+	EncodingUTF8BOM: unicode.UTF8BOM,
+	EncodingUTF16LE: unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	EncodingUTF16BE: unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	EncodingGBK:     simplifiedchinese.GBK,
+	EncodingGB18030: simplifiedchinese.GB18030,
+}
+
+// textContent 解码后的文本内容及其原始编码、换行符
+type textContent struct {
+	Text       string
+	Encoding   string
+	LineEnding string
+}
+
+// 检测文本编码，无法识别时返回 false
+func detectEncoding(data []byte) (string, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return EncodingUTF8BOM, true
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return EncodingUTF16LE, true
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return EncodingUTF16BE, true
+	case utf8.Valid(data):
+		return EncodingUTF8, true
+	}
+
+	// 非UTF-8时依次尝试GBK和GB18030，解码结果中出现替换字符说明不是该编码
+	for _, name := range []string{EncodingGBK, EncodingGB18030} {
+		decoded, err := textEncodingMap[name].NewDecoder().Bytes(data)
+		if err == nil && !bytes.ContainsRune(decoded, utf8.RuneError) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// 检测换行符风格，CRLF占多数时视为CRLF，其余情况视为LF
+func detectLineEnding(text string) string {
+	crlf := strings.Count(text, "\r\n")
+	lf := strings.Count(text, "\n") - crlf
+	if crlf > 0 && crlf >= lf {
+		return LineEndingCRLF
+	}
+	return LineEndingLF
+}
+
+// 解码文件内容
+func decodeText(data []byte) (*textContent, error) {
+	name, ok := detectEncoding(data)
+	if !ok {
+		return nil, newMessageError("encoding.unknown")
+	}
+
+	decoded, err := textEncodingMap[name].NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, newMessageError("encoding.decode_failed", name, err)
+	}
+
+	text := string(decoded)
+	return &textContent{
+		Text:       text,
+		Encoding:   name,
+		LineEnding: detectLineEnding(text),
+	}, nil
+}
+
+// 按指定编码和换行符风格编码文本
+func encodeText(text, encodingName, lineEnding string) ([]byte, error) {
+	enc, ok := textEncodingMap[encodingName]
+	if !ok {
+		return nil, newMessageError("encoding.unsupported", encodingName)
+	}
+
+	// 浏览器提交表单时换行符统一为CRLF，先还原为LF再转换
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	switch lineEnding {
+	case LineEndingLF:
+	case LineEndingCRLF:
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	default:
+		return nil, newMessageError("encoding.unsupported_line_ending", lineEnding)
+	}
+
+	encoded, err := enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		return nil, newMessageError("encoding.unencodable", encodingName, err)
+	}
+	return encoded, nil
+}
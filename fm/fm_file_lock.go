@@ -0,0 +1,18 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import "os"
+
+// 锁定 path.lock，多个实例共享同一个文件时串行化"读取-修改-写入"，返回的函数释放锁
+// 锁随文件描述符关闭而释放，进程退出时不会留下失效的锁
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockExclusive(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() { f.Close() }, nil
+}
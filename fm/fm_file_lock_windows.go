@@ -0,0 +1,15 @@
+//go:build windows
+
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// 阻塞直到获得排他锁
+func lockExclusive(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{})
+}
@@ -0,0 +1,133 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// 家目录模板中的用户名占位符
+const homeUsernamePlaceholder = "{username}"
+
+// 校验家目录模板，/ 表示不限制
+func validateHomeDir(home string) error {
+	_, err := cleanSegments(strings.ReplaceAll(home, homeUsernamePlaceholder, "user"))
+	return err
+}
+
+// 用户名能否作为家目录的一段
+func validHomeUsername(username string) bool {
+	return username != "" && username != "." && username != ".." && !strings.ContainsAny(username, "/\\")
+}
+
+// 用户的家目录，相对根目录，为空时不限制。管理员不受限制，用户自身的 home 优先于 home_dir，游客只使用自身的 home
+func (fm *FileManager) homeFor(user User) (string, error) {
+	home := user.Home
+	switch {
+	case user.IsAdmin():
+		return "", nil
+	case home != "":
+	case fm.homeDir == "" || user.Username == fm.users.guest().Username:
+		return "", nil
+	default:
+		home = fm.homeDir
+	}
+	if strings.Contains(home, homeUsernamePlaceholder) && !validHomeUsername(user.Username) {
+		return "", fmt.Errorf("用户名 %q 不能用作家目录", user.Username)
+	}
+	segments, err := cleanSegments(strings.ReplaceAll(home, homeUsernamePlaceholder, user.Username))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// 用户可见的根目录，有家目录时为家目录，不存在时自动创建
+func (fm *FileManager) filesFor(user User) (*rootFS, error) {
+	home, err := fm.homeFor(user)
+	if err != nil || home == "" {
+		return fm.files, err
+	}
+	return fm.files.sub(home)
+}
+
+// 家目录视图，家目录显示为 /，请求路径和符号链接都不能离开家目录
+func (r *rootFS) sub(home string) (*rootFS, error) {
+	if r.mounts != nil {
+		resolved, err := r.resolve(home)
+		if err != nil {
+			return nil, err
+		}
+		m, rel, err := r.mountOf(resolved)
+		if err != nil || rel == "" {
+			return m, err
+		}
+		return m.sub(rel)
+	}
+
+	r.mu.Lock()
+	view, ok := r.subs[home]
+	r.mu.Unlock()
+	if ok {
+		return view, nil
+	}
+
+	resolved, err := r.resolve(home)
+	if err != nil {
+		return nil, err
+	}
+	if _, statErr := r.Stat(resolved); errors.Is(statErr, fs.ErrNotExist) {
+		if err = r.MkdirAll(resolved, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if r.policy == SymlinkAllow {
+		view = &rootFS{dir: filepath.Join(r.dir, filepath.FromSlash(resolved)), policy: r.policy, readOnly: r.readOnly, maxUpload: r.maxUpload}
+	} else {
+		root, realDir, handleErr := r.handle()
+		if handleErr != nil {
+			return nil, handleErr
+		}
+		subRoot, openErr := root.OpenRoot(rootName(resolved))
+		if openErr != nil {
+			return nil, openErr
+		}
+		dir := filepath.Join(realDir, filepath.FromSlash(resolved))
+		view = &rootFS{dir: dir, policy: r.policy, readOnly: r.readOnly, maxUpload: r.maxUpload, root: subRoot, realDir: dir}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.subs[home]; ok {
+		if view.root != nil {
+			view.root.Close()
+		}
+		return existing, nil
+	}
+	if r.subs == nil {
+		r.subs = map[string]*rootFS{}
+	}
+	r.subs[home] = view
+	return view, nil
+}
+
+// SetHomeDir 设置非管理员用户的家目录模板，如 home/{username}，相对根目录，用户只能看到自己的家目录，
+// 首次登录或访问时自动创建，为空时不限制
+func (fm *FileManager) SetHomeDir(dir string) *FileManager {
+	if err := fm.setHomeDir(dir); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setHomeDir(dir string) error {
+	if err := validateHomeDir(dir); err != nil {
+		return fmt.Errorf("home_dir: %q %v", dir, err)
+	}
+	fm.homeDir = dir
+	fm.roles.invalidate()
+	return nil
+}
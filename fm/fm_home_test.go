@@ -0,0 +1,175 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 创建 dir 下的文件，文件名使用 / 分隔
+func writeTestFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 家目录模板按用户名展开，用户自身的 home 优先，管理员和游客不受 home_dir 限制
+func TestHomeFor(t *testing.T) {
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetHomeDir("home/{username}")
+	tests := []struct {
+		name    string
+		user    User
+		home    string
+		wantErr bool
+	}{
+		{"template", User{Username: "alice"}, "home/alice", false},
+		{"own home", User{Username: "alice", Home: "shared/team"}, "shared/team", false},
+		{"own template", User{Username: "alice", Home: "/users/{username}/"}, "users/alice", false},
+		{"unrestricted", User{Username: "alice", Home: "/"}, "", false},
+		{"admin", User{Username: "root", Roles: []string{RoleAdmin}, Home: "home/root"}, "", false},
+		{"guest", User{Username: "guest"}, "", false},
+		{"guest with own home", User{Username: "guest", Home: "public"}, "public", false},
+		{"username with slash", User{Username: "a/b"}, "", true},
+		{"username dot dot", User{Username: ".."}, "", true},
+		{"home leaves root", User{Username: "alice", Home: "../outside"}, "", true},
+	}
+	for _, tt := range tests {
+		home, err := fm.homeFor(tt.user)
+		if home != tt.home || (err != nil) != tt.wantErr {
+			t.Errorf("%s: homeFor = %q, %v, want %q, error %v", tt.name, home, err, tt.home, tt.wantErr)
+		}
+	}
+}
+
+// 家目录显示为 /，请求路径映射到家目录中且不能离开家目录
+func TestHomeView(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "home/alice/notes.txt", "home/alice/docs/a.txt", "home/bob/secret.txt")
+	fm := NewFileManager(dir, zap.NewNop()).SetHomeDir("home/{username}")
+	files, err := fm.filesFor(User{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path    string
+		content string
+	}{
+		{"notes.txt", "home/alice/notes.txt"},
+		{"/docs/a.txt", "home/alice/docs/a.txt"},
+		{"docs/../notes.txt", "home/alice/notes.txt"},
+		{"../bob/secret.txt", ""},
+		{"home/alice/notes.txt", ""},
+	}
+	for _, tt := range tests {
+		var data []byte
+		resolved, err := files.resolve(tt.path)
+		if err == nil {
+			data, err = files.ReadFile(resolved)
+		}
+		if got := string(data); got != tt.content || (err != nil) != (tt.content == "") {
+			t.Errorf("ReadFile(%q) = %q, %v, want %q", tt.path, got, err, tt.content)
+		}
+	}
+
+	// 不存在的家目录在首次访问时创建
+	if _, err = fm.filesFor(User{Username: "carol"}); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, filepath.Join(dir, "home", "carol"))
+}
+
+// 家目录中的路径按相对根目录的路径匹配路径规则、acl 和挂载点的默认权限
+func TestHomePathRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "home/alice/notes.txt", "home/alice/private/key.txt", "home/alice/secret.txt", "private/other.txt")
+	fm := NewFileManager(dir, zap.NewNop()).SetHomeDir("home/{username}").SetUsers(map[string]User{
+		"alice": {
+			Username:                 "alice",
+			EncryptPassword:          DefaultHashPassword("secret"),
+			Permissions:              map[string]bool{PermissionDirView: true, PermissionFileView: true, PermissionFileEdit: true},
+			BaseRolePathRestrictions: []string{"/home"},
+			BaseRolePathBlocking:     []string{"/home/alice/private"},
+			ACL:                      []ACLRule{{Path: "/home/alice/secret.txt", Deny: []string{PermissionFileView}}},
+		},
+	})
+	alice, ok := fm.lookupUser("alice")
+	if !ok {
+		t.Fatal("alice not found")
+	}
+
+	tests := []struct {
+		path    string
+		allowed bool
+		view    bool
+	}{
+		{"", true, true},
+		{"notes.txt", true, true},
+		{"private", false, true},
+		{"private/key.txt", false, true},
+		{"secret.txt", true, false},
+	}
+	for _, tt := range tests {
+		if got := alice.IsPathAllowed(tt.path); got != tt.allowed {
+			t.Errorf("IsPathAllowed(%q) = %v, want %v", tt.path, got, tt.allowed)
+		}
+		if got := alice.Can(PermissionFileView, tt.path); got != tt.view {
+			t.Errorf("Can(file:view, %q) = %v, want %v", tt.path, got, tt.view)
+		}
+	}
+
+	engine := fm.engine()
+	cookies := testLogin(t, engine, "alice", "secret")
+	for target, status := range map[string]int{
+		"/file?path=notes.txt":       http.StatusOK,
+		"/file?path=private/key.txt": http.StatusForbidden,
+		"/file?path=secret.txt":      http.StatusForbidden,
+	} {
+		if recorder := serveTest(engine, http.MethodGet, target, cookies); recorder.Code != status {
+			t.Errorf("GET %s = %d, want %d", target, recorder.Code, status)
+		}
+	}
+}
+
+// 挂载点中的家目录仍然使用挂载点的默认权限和只读设置
+func TestHomeInsideMount(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "scratch/home/alice/a.txt", "logs/home/alice/app.log")
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetMounts(map[string]MountConfig{
+		"scratch": {Dir: filepath.Join(dir, "scratch"), Permissions: []string{PermissionDirView, PermissionFileView}},
+		"logs":    {Dir: filepath.Join(dir, "logs"), ReadOnly: true},
+	})
+	alice := User{
+		Username:                 "alice",
+		Permissions:              map[string]bool{PermissionDirView: true, PermissionFileView: true, PermissionFileEdit: true},
+		BaseRolePathRestrictions: []string{"/"},
+	}
+
+	alice.Home = "scratch/home/{username}"
+	resolved := fm.resolveUser(alice)
+	if !resolved.Can(PermissionFileView, "a.txt") || resolved.Can(PermissionFileEdit, "a.txt") {
+		t.Error("mount defaults are not applied inside the home")
+	}
+
+	alice.Home = "logs/home/{username}"
+	resolved = fm.resolveUser(alice)
+	files, err := fm.filesFor(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fm.readOnlyReason(files, "app.log") == "" {
+		t.Error("read-only mount is writable inside the home")
+	}
+}
@@ -0,0 +1,262 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// 内置语言
+const (
+	LocaleZhCN = "zh-CN"
+	LocaleEnUS = "en-US"
+)
+
+const (
+	localePattern   = "locales/*.json"
+	localeQueryKey  = "lang"
+	localeCookieKey = "_lang"
+	localeCtxKey    = "locale"
+)
+
+// messageCatalog 各语言的消息目录，缺失的消息回退到默认语言，仍缺失时直接显示消息键
+type messageCatalog struct {
+	defaultLocale string
+	messages      map[string]map[string]string
+	locales       []string
+	matcher       language.Matcher
+}
+
+// 加载消息目录，自定义目录中的同名消息覆盖内置消息，也可以新增语言
+func loadMessageCatalog(defaultLocale string, fsyss ...fs.FS) (*messageCatalog, error) {
+	messages := make(map[string]map[string]string)
+	for _, fsys := range fsyss {
+		if fsys == nil {
+			continue
+		}
+		matches, err := fs.Glob(fsys, localePattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			data, err := fs.ReadFile(fsys, match)
+			if err != nil {
+				return nil, err
+			}
+			var catalog map[string]string
+			if err = json.Unmarshal(data, &catalog); err != nil {
+				return nil, fmt.Errorf("解析语言文件 %s 失败: %v", match, err)
+			}
+
+			locale := strings.TrimSuffix(path.Base(match), ".json")
+			if _, err = language.Parse(locale); err != nil {
+				return nil, fmt.Errorf("语言文件 %s 的名称不是合法的语言标签: %v", match, err)
+			}
+			if messages[locale] == nil {
+				messages[locale] = make(map[string]string)
+			}
+			for key, message := range catalog {
+				messages[locale][key] = message
+			}
+		}
+	}
+
+	if _, ok := messages[defaultLocale]; !ok {
+		return nil, fmt.Errorf("默认语言 %s 没有对应的语言文件", defaultLocale)
+	}
+
+	// 默认语言放在首位，语言匹配失败时使用
+	locales := []string{defaultLocale}
+	for locale := range messages {
+		if locale != defaultLocale {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales[1:])
+
+	tags := make([]language.Tag, 0, len(locales))
+	for _, locale := range locales {
+		tags = append(tags, language.MustParse(locale))
+	}
+
+	return &messageCatalog{
+		defaultLocale: defaultLocale,
+		messages:      messages,
+		locales:       locales,
+		matcher:       language.NewMatcher(tags),
+	}, nil
+}
+
+// 翻译消息，有参数时按 fmt 格式化
+func (mc *messageCatalog) translate(locale, key string, args ...any) string {
+	message, ok := mc.messages[locale][key]
+	if !ok {
+		if message, ok = mc.messages[mc.defaultLocale][key]; !ok {
+			message = key
+		}
+	}
+	if len(args) == 0 {
+		return message
+	}
+
+	// 参数中的消息错误同样按当前语言翻译
+	translated := make([]any, len(args))
+	for i, arg := range args {
+		translated[i] = arg
+		var msgErr *messageError
+		if err, isErr := arg.(error); isErr && errors.As(err, &msgErr) {
+			translated[i] = mc.translate(locale, msgErr.Key, msgErr.Args...)
+		}
+	}
+	return fmt.Sprintf(message, translated...)
+}
+
+// 判断是否支持该语言
+func (mc *messageCatalog) supports(locale string) bool {
+	_, ok := mc.messages[locale]
+	return ok
+}
+
+// 按 Accept-Language 匹配语言
+func (mc *messageCatalog) match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return mc.defaultLocale
+	}
+	_, index, confidence := mc.matcher.Match(tags...)
+	if confidence == language.No {
+		return mc.defaultLocale
+	}
+	return mc.locales[index]
+}
+
+// messageError 可按请求语言翻译的错误
+type messageError struct {
+	Key  string
+	Args []any
+}
+
+func newMessageError(key string, args ...any) error {
+	return &messageError{Key: key, Args: args}
+}
+
+// Error 返回默认中文消息，用于日志
+func (e *messageError) Error() string {
+	if defaultMessageCatalog == nil {
+		return e.Key
+	}
+	return defaultMessageCatalog.translate(LocaleZhCN, e.Key, e.Args...)
+}
+
+// 内置消息目录，用于无请求上下文时的错误消息
+var defaultMessageCatalog, _ = loadMessageCatalog(LocaleZhCN, defaultUIFS)
+
+// 语言选择中间件，?lang= 参数切换语言并记录到cookie
+func (fm *FileManager) localeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if locale := c.Query(localeQueryKey); locale != "" && fm.messages.supports(locale) {
+			c.SetCookie(fm.cookieName+localeCookieKey, locale, 365*24*3600, "/", "", false, true)
+			c.Set(localeCtxKey, locale)
+		}
+		c.Next()
+	}
+}
+
+// 获取请求的语言，优先级: ?lang= 参数 > cookie > 用户设置 > Accept-Language > 默认语言
+func (fm *FileManager) localeOf(c *gin.Context) string {
+	if locale := c.GetString(localeCtxKey); locale != "" {
+		return locale
+	}
+
+	locale := ""
+	if cookie, err := c.Cookie(fm.cookieName + localeCookieKey); err == nil && fm.messages.supports(cookie) {
+		locale = cookie
+	} else if user, ok := c.Get("user"); ok && fm.messages.supports(user.(User).Locale) {
+		locale = user.(User).Locale
+	} else {
+		locale = fm.messages.match(c.GetHeader("Accept-Language"))
+	}
+
+	c.Set(localeCtxKey, locale)
+	return locale
+}
+
+// 按请求语言翻译消息
+func (fm *FileManager) t(c *gin.Context, key string, args ...any) string {
+	return fm.messages.translate(fm.localeOf(c), key, args...)
+}
+
+// 判断客户端是否期望JSON响应
+func wantsJSON(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "application/json") ||
+		strings.HasPrefix(c.GetHeader("Content-Type"), "application/json")
+}
+
+// 按请求语言返回错误，JSON请求返回 {"code","error"}，浏览器请求返回错误页面，其余返回纯文本
+func (fm *FileManager) respondError(c *gin.Context, status int, key string, args ...any) {
+	message := fm.t(c, key, args...)
+	c.Set("errorMessage", message)
+
+	switch {
+	case wantsJSON(c):
+		c.JSON(status, gin.H{"code": key, "error": message})
+	case strings.Contains(c.GetHeader("Accept"), "text/html"):
+		user, exists := c.Get("user")
+		if !exists {
+			user = fm.guest()
+		}
+		fm.renderHTML(c, status, templateError, errorPageData{
+			pageData: fm.newPageData(c, user.(User)),
+			Message:  message,
+		})
+	default:
+		c.String(status, message)
+	}
+}
+
+// SetDefaultLocale 设置默认语言，浏览器语言无法匹配时使用
+func (fm *FileManager) SetDefaultLocale(locale string) *FileManager {
+	if err := fm.setDefaultLocale(locale); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setDefaultLocale(locale string) error {
+	messages, err := loadMessageCatalog(locale, defaultUIFS, fm.customUIFS)
+	if err != nil {
+		return fmt.Errorf("设置默认语言失败: %v", err)
+	}
+	fm.messages = messages
+	return nil
+}
+
+// localeOption 语言切换选项
+type localeOption struct {
+	Locale string
+	Name   string
+	URL    string
+}
+
+// 所有可选语言，切换链接保留当前页面的其他参数
+func (fm *FileManager) localeOptions(c *gin.Context) []localeOption {
+	options := make([]localeOption, 0, len(fm.messages.locales))
+	for _, locale := range fm.messages.locales {
+		query := c.Request.URL.Query()
+		query.Set(localeQueryKey, locale)
+		options = append(options, localeOption{
+			Locale: locale,
+			Name:   fm.messages.translate(locale, "lang.name"),
+			URL:    c.Request.URL.Path + "?" + query.Encode(),
+		})
+	}
+	return options
+}
@@ -0,0 +1,87 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 解析 IP 或 CIDR，单个 IP 视为只包含自身的网段
+func parseIPRule(rule string) (netip.Prefix, error) {
+	if strings.Contains(rule, "/") {
+		prefix, err := netip.ParsePrefix(rule)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(rule)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// 校验 IP 或 CIDR 列表
+func validateIPRules(field string, rules []string) []error {
+	var errs []error
+	for i, rule := range rules {
+		if _, err := parseIPRule(rule); err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d]: %q 不是合法的 IP 或 CIDR", field, i, rule))
+		}
+	}
+	return errs
+}
+
+// IPAllowed 判断用户能否从该地址访问，IP 和 AllowedIPs 都为空时不限制
+func (u *User) IPAllowed(clientIP string) bool {
+	rules := u.AllowedIPs
+	if u.IP != "" {
+		rules = append([]string{u.IP}, rules...)
+	}
+	if len(rules) == 0 {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, rule := range rules {
+		if prefix, err := parseIPRule(rule); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查用户能否从当前客户端地址访问，拒绝时记录审计日志
+func (fm *FileManager) checkClientIP(c *gin.Context, user User) bool {
+	if user.IPAllowed(c.ClientIP()) {
+		return true
+	}
+	fm.audit(c, AuditIPDenied, "username", user.Username)
+	return false
+}
+
+// SetTrustedProxies 设置反向代理的 IP 或 CIDR，只有来自这些地址的请求才使用 X-Forwarded-For、X-Real-IP 作为客户端地址，
+// 为空时总是使用连接的对端地址
+func (fm *FileManager) SetTrustedProxies(proxies []string) *FileManager {
+	if err := fm.setTrustedProxies(proxies); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setTrustedProxies(proxies []string) error {
+	if errs := validateIPRules("trusted_proxies", proxies); len(errs) > 0 {
+		return errs[0]
+	}
+	fm.proxies = proxies
+	return nil
+}
@@ -0,0 +1,81 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestIPAllowed(t *testing.T) {
+	tests := []struct {
+		ip         string
+		allowedIPs []string
+		client     string
+		want       bool
+	}{
+		{"", nil, "198.51.100.7", true},
+		{"198.51.100.7", nil, "198.51.100.7", true},
+		{"198.51.100.7", nil, "198.51.100.8", false},
+		{"", []string{"10.0.0.0/8"}, "10.1.2.3", true},
+		{"", []string{"10.0.0.0/8"}, "11.1.2.3", false},
+		{"198.51.100.7", []string{"10.0.0.0/8"}, "10.1.2.3", true},
+		{"", []string{"10.0.0.0/8"}, "::ffff:10.1.2.3", true},
+		{"", []string{"2001:db8::/32"}, "2001:db8::1", true},
+		{"", []string{"2001:db8::/32"}, "2001:db9::1", false},
+		{"", []string{"10.0.0.0/8"}, "not an ip", false},
+	}
+	for _, tt := range tests {
+		user := User{IP: tt.ip, AllowedIPs: tt.allowedIPs}
+		if got := user.IPAllowed(tt.client); got != tt.want {
+			t.Errorf("IP %q AllowedIPs %q: IPAllowed(%s) = %v, want %v", tt.ip, tt.allowedIPs, tt.client, got, tt.want)
+		}
+	}
+}
+
+// 只有来自受信任代理的请求才使用 X-Forwarded-For 作为客户端地址
+func TestIPAllowedBehindTrustedProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetTrustedProxies([]string{"192.0.2.1"}).SetUsers(map[string]User{
+		"alice": {
+			Username:        "alice",
+			EncryptPassword: DefaultHashPassword("secret"),
+			Permissions:     map[string]bool{PermissionDirView: true},
+			AllowedIPs:      []string{"203.0.113.0/24"},
+		},
+	})
+	engine := fm.engine()
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		allowed   bool
+	}{
+		{"client behind trusted proxy", "192.0.2.1:1234", "203.0.113.5", true},
+		{"disallowed client behind trusted proxy", "192.0.2.1:1234", "198.51.100.5", false},
+		{"forged header from untrusted peer", "198.51.100.5:1234", "203.0.113.5", false},
+		{"direct allowed client", "203.0.113.5:1234", "", true},
+		{"trusted proxy itself", "192.0.2.1:1234", "", false},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodPost, "/file/login", strings.NewReader(url.Values{"username": {"alice"}, "password": {"secret"}}.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			request.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		location := recorder.Header().Get("Location")
+		allowed := recorder.Code == http.StatusSeeOther && !strings.Contains(location, "error=")
+		if allowed != tt.allowed || !allowed && !strings.Contains(location, "error="+loginErrorIP) {
+			t.Errorf("%s: %d %q, want allowed %v", tt.name, recorder.Code, location, tt.allowed)
+		}
+	}
+}
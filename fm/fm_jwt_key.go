@@ -0,0 +1,349 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 密钥目录中生成的私钥文件名前缀，后接生成时间
+const jwtKeyFilePrefix = "jwt-"
+
+// JWTKeyConfig JWT 签名密钥配置，未设置时每次启动生成临时密钥，重启后所有访问 token 失效
+type JWTKeyConfig struct {
+	PrivateKeyFile string   `json:"private_key_file,omitempty" yaml:"private_key_file,omitempty" toml:"private_key_file,omitempty"` // 签名私钥(PEM)，设置后总是用它签名
+	PublicKeyFiles []string `json:"public_key_files,omitempty" yaml:"public_key_files,omitempty" toml:"public_key_files,omitempty"` // 只用于验证的公钥(PEM)，轮换后保留旧公钥直到旧 token 过期
+	KeyDir         string   `json:"key_dir,omitempty"          yaml:"key_dir,omitempty"          toml:"key_dir,omitempty"`          // 密钥目录，其中所有 *.pem 公钥和私钥都用于验证，未设置 private_key_file 时用修改时间最新的私钥签名，目录中没有私钥时自动生成
+}
+
+// 是否配置了持久化的密钥
+func (kc JWTKeyConfig) configured() bool {
+	return kc.PrivateKeyFile != "" || kc.KeyDir != "" || len(kc.PublicKeyFiles) > 0
+}
+
+// Validate 校验密钥配置，文件内容在加载时校验
+func (kc JWTKeyConfig) Validate() error {
+	if len(kc.PublicKeyFiles) > 0 && kc.PrivateKeyFile == "" && kc.KeyDir == "" {
+		return errors.New("jwt.public_key_files: 需要同时设置 private_key_file 或 key_dir 提供签名私钥")
+	}
+	return nil
+}
+
+// jwtKeySet 签名私钥和所有可用于验证的公钥，按 kid 查找
+type jwtKeySet struct {
+	signingID string
+	signing   *rsa.PrivateKey
+	public    map[string]*rsa.PublicKey
+}
+
+// jwtKeyRing 当前使用的密钥集合，重新加载时整体替换
+type jwtKeyRing struct {
+	config JWTKeyConfig // 为空时使用启动时生成的临时密钥
+	keys   atomic.Pointer[jwtKeySet]
+}
+
+func newJWTKeyRing(keys *jwtKeySet) *jwtKeyRing {
+	ring := &jwtKeyRing{}
+	ring.keys.Store(keys)
+	return ring
+}
+
+func (ring *jwtKeyRing) current() *jwtKeySet {
+	return ring.keys.Load()
+}
+
+// 创建密钥集合，签名私钥的公钥总是可用于验证
+func newJWTKeySet(signing *rsa.PrivateKey, verify ...*rsa.PublicKey) *jwtKeySet {
+	keys := &jwtKeySet{
+		signingID: jwkThumbprint(&signing.PublicKey),
+		signing:   signing,
+		public:    map[string]*rsa.PublicKey{},
+	}
+	keys.public[keys.signingID] = &signing.PublicKey
+	for _, key := range verify {
+		if key != nil {
+			keys.public[jwkThumbprint(key)] = key
+		}
+	}
+	return keys
+}
+
+// 按 JWT 头部的 kid 选择验证公钥，没有 kid 的 token 使用签名私钥验证
+func (keys *jwtKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return &keys.signing.PublicKey, nil
+	}
+	key, ok := keys.public[kid]
+	if !ok {
+		return nil, fmt.Errorf("未知的密钥 %q", kid)
+	}
+	return key, nil
+}
+
+// RFC 7638 JWK 指纹，作为 kid，同一个公钥在所有实例上得到相同的 kid
+func jwkThumbprint(key *rsa.PublicKey) string {
+	jwk := rsaJWK(key, "")
+	data, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{jwk.E, jwk.Kty, jwk.N})
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS 中的一个公钥
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func rsaJWK(key *rsa.PublicKey, kid string) jwk {
+	return jwk{
+		Kty: "RSA",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// 按 kid 排序的公钥列表，签名公钥排在最前
+func (keys *jwtKeySet) jwks() []jwk {
+	ids := make([]string, 0, len(keys.public))
+	for kid := range keys.public {
+		if kid != keys.signingID {
+			ids = append(ids, kid)
+		}
+	}
+	slices.Sort(ids)
+	ids = slices.Insert(ids, 0, keys.signingID)
+
+	set := make([]jwk, 0, len(ids))
+	for _, kid := range ids {
+		key := rsaJWK(keys.public[kid], kid)
+		key.Use, key.Alg = "sig", jwt.SigningMethodRS256.Alg()
+		set = append(set, key)
+	}
+	return set
+}
+
+// 按配置加载密钥
+func loadJWTKeys(config JWTKeyConfig) (*jwtKeySet, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	var (
+		signing *rsa.PrivateKey
+		verify  []*rsa.PublicKey
+	)
+	if config.KeyDir != "" {
+		newest, public, err := loadJWTKeyDir(config.KeyDir)
+		if err != nil {
+			return nil, fmt.Errorf("key_dir: %v", err)
+		}
+		signing, verify = newest, public
+	}
+	if config.PrivateKeyFile != "" {
+		private, _, err := readPEMKey(config.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("private_key_file: %v", err)
+		}
+		if private == nil {
+			return nil, fmt.Errorf("private_key_file: %s 不是私钥", config.PrivateKeyFile)
+		}
+		signing = private
+	}
+	for i, path := range config.PublicKeyFiles {
+		_, public, err := readPEMKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("public_key_files[%d]: %v", i, err)
+		}
+		verify = append(verify, public)
+	}
+	return newJWTKeySet(signing, verify...), nil
+}
+
+// 读取密钥目录，返回修改时间最新的私钥和所有公钥，目录中没有私钥时生成一个
+func loadJWTKeyDir(dir string) (*rsa.PrivateKey, []*rsa.PublicKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		newest     *rsa.PrivateKey
+		newestTime time.Time
+		public     []*rsa.PublicKey
+	)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		private, key, err := readPEMKey(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		public = append(public, key)
+		if private != nil && (newest == nil || info.ModTime().After(newestTime)) {
+			newest, newestTime = private, info.ModTime()
+		}
+	}
+	if newest != nil {
+		return newest, public, nil
+	}
+
+	path, err := GenerateJWTKey(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	newest, _, err = readPEMKey(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newest, public, nil
+}
+
+// 读取 PEM 文件中的 RSA 私钥或公钥，公钥文件返回的私钥为 nil
+func readPEMKey(path string) (*rsa.PrivateKey, *rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("%s 不是 PEM 格式", path)
+	}
+
+	var key any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, nil, fmt.Errorf("%s: 不支持的 PEM 类型 %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, &key.PublicKey, nil
+	case *rsa.PublicKey:
+		return nil, key, nil
+	default:
+		return nil, nil, fmt.Errorf("%s: 只支持 RSA 密钥", path)
+	}
+}
+
+// GenerateJWTKey 在目录中生成新的 RSA 私钥(PKCS#8 PEM，权限 0600)并返回文件路径，
+// 密钥目录中修改时间最新的私钥用于签名，因此生成后重启或发送 SIGHUP 即完成轮换
+func GenerateJWTKey(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	privateKey, _, err := generateRSAKeyPair()
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, jwtKeyFilePrefix+time.Now().UTC().Format("20060102T150405Z")+".pem")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if err = pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// SetJWTKeys 从 PEM 文件或密钥目录加载签名密钥，多个实例使用相同的密钥时可以验证彼此签发的 token
+func (fm *FileManager) SetJWTKeys(config JWTKeyConfig) *FileManager {
+	if err := fm.setJWTKeys(config); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setJWTKeys(config JWTKeyConfig) error {
+	keys, err := loadJWTKeys(config)
+	if err != nil {
+		return err
+	}
+	fm.jwtKeys.config = config
+	fm.jwtKeys.keys.Store(keys)
+	return nil
+}
+
+// ReloadJWTKeys 重新读取密钥文件，失败时保留当前密钥
+func (fm *FileManager) ReloadJWTKeys() error {
+	if !fm.jwtKeys.config.configured() {
+		return errors.New("未配置 JWT 密钥文件")
+	}
+	keys, err := loadJWTKeys(fm.jwtKeys.config)
+	if err != nil {
+		return err
+	}
+	fm.jwtKeys.keys.Store(keys)
+	fm.log.Infof("已重新加载 JWT 密钥，签名密钥 %s，共 %d 个验证公钥", keys.signingID, len(keys.public))
+	return nil
+}
+
+// 收到 SIGHUP 时重新加载密钥
+func (fm *FileManager) watchJWTKeys() {
+	if !fm.jwtKeys.config.configured() {
+		fm.log.Warn("未配置 JWT 密钥，使用临时密钥，重启后需要重新登录")
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := fm.ReloadJWTKeys(); err != nil {
+				fm.log.Errorf("重新加载 JWT 密钥失败: %v", err)
+			}
+		}
+	}()
+}
+
+// 公开验证 token 所需的公钥，供其他服务验证本服务签发的 token
+func (fm *FileManager) handleJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": fm.jwtKeys.current().jwks()})
+}
@@ -0,0 +1,105 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// 签名时写入 kid，按 kid 选择验证公钥；密钥目录中新增私钥后用最新的私钥签名，旧公钥在删除前仍可验证
+func TestJWTKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetJWTKeys(JWTKeyConfig{KeyDir: dir})
+	oldKeys := fm.jwtKeys.current()
+	oldToken, err := fm.signJWTToken(JWTClaims{Username: "alice"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一秒内生成的文件名相同，在其他目录生成后移入并设置更新的修改时间
+	generated, err := GenerateJWTKey(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPath := filepath.Join(dir, "jwt-new.pem")
+	if err = os.Rename(generated, newPath); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err = os.Chtimes(newPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err = fm.ReloadJWTKeys(); err != nil {
+		t.Fatal(err)
+	}
+	newKeys := fm.jwtKeys.current()
+	if newKeys.signingID == oldKeys.signingID || len(newKeys.jwks()) != 2 {
+		t.Fatalf("signing key %s after rotation, %d public keys", newKeys.signingID, len(newKeys.jwks()))
+	}
+	newToken, err := fm.signJWTToken(JWTClaims{Username: "alice"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(keys *jwtKeySet, kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, JWTClaims{
+			Username:         "alice",
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+		})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(keys.signing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	private, _, err := generateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := newJWTKeySet(private)
+
+	// 另一个实例使用同一个密钥目录时可以验证彼此签发的 token
+	other := NewFileManager(t.TempDir(), zap.NewNop()).SetJWTKeys(JWTKeyConfig{KeyDir: dir})
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"old key", oldToken, true},
+		{"new key", newToken, true},
+		{"no kid with signing key", sign(newKeys, ""), true},
+		{"no kid with old key", sign(oldKeys, ""), false},
+		{"unknown kid", sign(foreign, foreign.signingID), false},
+		{"kid of another key", sign(foreign, newKeys.signingID), false},
+	}
+	for _, tt := range tests {
+		for _, manager := range []*FileManager{fm, other} {
+			if _, err := manager.validateJWTToken(tt.token); (err == nil) != tt.valid {
+				t.Errorf("%s: err = %v, want valid %v", tt.name, err, tt.valid)
+			}
+		}
+	}
+
+	// 删除旧私钥后旧 token 失效
+	paths, _ := filepath.Glob(filepath.Join(dir, jwtKeyFilePrefix+"2*.pem"))
+	for _, path := range paths {
+		os.Remove(path)
+	}
+	if err = fm.ReloadJWTKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fm.validateJWTToken(oldToken); err == nil {
+		t.Error("token signed by a removed key is still valid")
+	}
+	if _, err = fm.validateJWTToken(newToken); err != nil {
+		t.Errorf("token signed by the current key: %v", err)
+	}
+}
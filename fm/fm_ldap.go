@@ -0,0 +1,309 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	defaultLDAPUserFilter     = "(uid=%s)"
+	defaultLDAPGroupAttribute = "memberOf"
+	defaultLDAPTimeout        = 5 * time.Second
+	defaultLDAPCacheTTL       = 5 * time.Minute
+)
+
+// LDAPConfig LDAP 认证配置
+type LDAPConfig struct {
+	URL                string         `json:"url"                            yaml:"url"                            toml:"url"`                            // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool           `json:"start_tls,omitempty"            yaml:"start_tls,omitempty"            toml:"start_tls,omitempty"`            // ldap:// 连接后升级为 TLS
+	InsecureSkipVerify bool           `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty" toml:"insecure_skip_verify,omitempty"` // 跳过证书校验，仅用于测试
+	BindDN             string         `json:"bind_dn,omitempty"              yaml:"bind_dn,omitempty"              toml:"bind_dn,omitempty"`              // 查询用户的服务账号，为空时匿名查询
+	BindPassword       string         `json:"bind_password,omitempty"        yaml:"bind_password,omitempty"        toml:"bind_password,omitempty"`
+	BaseDN             string         `json:"base_dn"                        yaml:"base_dn"                        toml:"base_dn"`
+	UserFilter         string         `json:"user_filter,omitempty"          yaml:"user_filter,omitempty"          toml:"user_filter,omitempty"`     // %s 替换为转义后的用户名，默认 (uid=%s)
+	GroupAttribute     string         `json:"group_attribute,omitempty"      yaml:"group_attribute,omitempty"      toml:"group_attribute,omitempty"` // 用户条目上记录所属组的属性，默认 memberOf
+	GroupBaseDN        string         `json:"group_base_dn,omitempty"        yaml:"group_base_dn,omitempty"        toml:"group_base_dn,omitempty"`   // 设置后改为在该 DN 下搜索组
+	GroupFilter        string         `json:"group_filter,omitempty"         yaml:"group_filter,omitempty"         toml:"group_filter,omitempty"`    // 搜索组的过滤器，%s 替换为用户 DN，如 (member=%s)
+	Groups             []GroupMapping `json:"groups"                         yaml:"groups"                         toml:"groups"`
+	Timeout            Duration       `json:"timeout,omitempty"              yaml:"timeout,omitempty"              toml:"timeout,omitempty"`
+	CacheTTL           Duration       `json:"cache_ttl,omitempty"            yaml:"cache_ttl,omitempty"            toml:"cache_ttl,omitempty"` // 用户信息缓存时间，会话每次请求都会查询用户
+}
+
+// Validate 校验 LDAP 配置
+func (lc *LDAPConfig) Validate() error {
+	var errs []error
+	if u, err := url.Parse(lc.URL); err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("ldap.url: %q 应为 ldap://host:port 或 ldaps://host:port", lc.URL))
+	}
+	if lc.BaseDN == "" {
+		errs = append(errs, errors.New("ldap.base_dn: 不能为空"))
+	}
+	if lc.UserFilter != "" && strings.Count(lc.UserFilter, "%s") != 1 {
+		errs = append(errs, fmt.Errorf("ldap.user_filter: %q 必须包含一个 %%s", lc.UserFilter))
+	}
+	if lc.GroupBaseDN != "" && strings.Count(lc.GroupFilter, "%s") != 1 {
+		errs = append(errs, errors.New("ldap.group_filter: 设置 group_base_dn 时必须包含一个 %s"))
+	}
+	errs = append(errs, validateGroupMappings("ldap.groups", lc.Groups)...)
+	return errors.Join(errs...)
+}
+
+// ldapConn 认证用到的 LDAP 连接操作，*ldap.Conn 实现了该接口，测试时可以替换为内存中的目录
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+type ldapCacheEntry struct {
+	user    User
+	expires time.Time
+}
+
+// LDAPAuthenticator 通过 LDAP 认证用户并按组映射角色和权限
+// LDAP 中不存在、未映射到任何组或 LDAP 不可用时交给 fallback 中的本地用户，用户的增删改也由 fallback 处理
+type LDAPAuthenticator struct {
+	config   LDAPConfig
+	fallback UserStore
+	dial     func() (ldapConn, error) // 默认为 dialLDAP
+
+	mu    sync.Mutex
+	cache map[string]ldapCacheEntry
+}
+
+// NewLDAPAuthenticator 创建 LDAP 认证，fallback 为本地用户存储，可以为空
+func NewLDAPAuthenticator(config LDAPConfig, fallback UserStore) (*LDAPAuthenticator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = defaultLDAPUserFilter
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = defaultLDAPGroupAttribute
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = Duration(defaultLDAPTimeout)
+	}
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = Duration(defaultLDAPCacheTTL)
+	}
+	if fallback == nil {
+		fallback = newUserRegistry(User{})
+	}
+	la := &LDAPAuthenticator{
+		config:   config,
+		fallback: fallback,
+		cache:    map[string]ldapCacheEntry{},
+	}
+	la.dial = la.dialLDAP
+	return la, nil
+}
+
+// 连接 LDAP 服务器
+func (la *LDAPAuthenticator) dialLDAP() (ldapConn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: la.config.InsecureSkipVerify}
+	if u, err := url.Parse(la.config.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := ldap.DialURL(la.config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(time.Duration(la.config.Timeout))
+	if la.config.StartTLS {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// 以服务账号绑定，未配置时保持匿名
+func (la *LDAPAuthenticator) bindService(conn ldapConn) error {
+	if la.config.BindDN == "" {
+		return nil
+	}
+	return conn.Bind(la.config.BindDN, la.config.BindPassword)
+}
+
+// 按用户名查找用户条目，不存在时返回 ErrUserNotFound
+func (la *LDAPAuthenticator) searchUser(conn ldapConn, username string) (*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(
+		la.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(time.Duration(la.config.Timeout).Seconds()), false,
+		fmt.Sprintf(la.config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", la.config.GroupAttribute},
+		nil,
+	)
+	result, err := conn.Search(request)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUserNotFound
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, fmt.Errorf("LDAP 中存在多个用户 %s", username)
+	}
+}
+
+// 获取用户所属的组
+func (la *LDAPAuthenticator) userGroups(conn ldapConn, entry *ldap.Entry) ([]string, error) {
+	if la.config.GroupBaseDN == "" {
+		return entry.GetAttributeValues(la.config.GroupAttribute), nil
+	}
+
+	request := ldap.NewSearchRequest(
+		la.config.GroupBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(time.Duration(la.config.Timeout).Seconds()), false,
+		fmt.Sprintf(la.config.GroupFilter, ldap.EscapeFilter(entry.DN)),
+		[]string{"dn"},
+		nil,
+	)
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, group := range result.Entries {
+		groups = append(groups, group.DN)
+	}
+	return groups, nil
+}
+
+// 组名可以是 CN 或完整 DN，均不区分大小写
+func ldapGroupMatches(mapping, groupDN string) bool {
+	if strings.EqualFold(mapping, groupDN) {
+		return true
+	}
+	dn, err := ldap.ParseDN(groupDN)
+	if err != nil || len(dn.RDNs) == 0 {
+		return false
+	}
+	for _, attr := range dn.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") && strings.EqualFold(attr.Value, mapping) {
+			return true
+		}
+	}
+	return false
+}
+
+// 查找并映射 LDAP 用户，verify 为 true 时同时以用户 DN 和密码绑定校验密码
+func (la *LDAPAuthenticator) fetch(username, password string, verify bool) (User, error) {
+	conn, err := la.dial()
+	if err != nil {
+		return User{}, fmt.Errorf("连接 LDAP 失败: %w", err)
+	}
+	defer conn.Close()
+
+	if err = la.bindService(conn); err != nil {
+		return User{}, fmt.Errorf("LDAP 服务账号绑定失败: %w", err)
+	}
+	entry, err := la.searchUser(conn, username)
+	if err != nil {
+		return User{}, err
+	}
+	if verify {
+		if err = conn.Bind(entry.DN, password); err != nil {
+			if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+				return User{}, ErrInvalidPassword
+			}
+			return User{}, fmt.Errorf("LDAP 用户绑定失败: %w", err)
+		}
+		// 用户本身可能无权读取组，重新以服务账号查询
+		if err = la.bindService(conn); err != nil {
+			return User{}, fmt.Errorf("LDAP 服务账号绑定失败: %w", err)
+		}
+	}
+	groups, err := la.userGroups(conn, entry)
+	if err != nil {
+		return User{}, fmt.Errorf("查询 LDAP 用户组失败: %w", err)
+	}
+	user, ok := mapGroups(username, groups, la.config.Groups, ldapGroupMatches)
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+
+	la.mu.Lock()
+	la.cache[username] = ldapCacheEntry{user: user, expires: time.Now().Add(time.Duration(la.config.CacheTTL))}
+	la.mu.Unlock()
+	return user, nil
+}
+
+// 查询结果为用户不存在或 LDAP 不可用时交给本地用户，本地也不存在时返回 LDAP 的错误便于排查
+func (la *LDAPAuthenticator) orFallback(user User, err error, fallback func() (User, error)) (User, error) {
+	if err == nil || errors.Is(err, ErrInvalidPassword) {
+		return user, err
+	}
+	local, localErr := fallback()
+	if errors.Is(localErr, ErrUserNotFound) && !errors.Is(err, ErrUserNotFound) {
+		return User{}, err
+	}
+	return local, localErr
+}
+
+// Lookup 优先使用缓存，缓存过期后重新查询 LDAP，LDAP 不可用时继续使用过期的缓存
+func (la *LDAPAuthenticator) Lookup(username string) (User, error) {
+	la.mu.Lock()
+	entry, cached := la.cache[username]
+	la.mu.Unlock()
+	if cached && time.Now().Before(entry.expires) {
+		return entry.user, nil
+	}
+
+	user, err := la.fetch(username, "", false)
+	if errors.Is(err, ErrUserNotFound) {
+		la.mu.Lock()
+		delete(la.cache, username)
+		la.mu.Unlock()
+	} else if err != nil && cached {
+		return entry.user, nil
+	}
+	return la.orFallback(user, err, func() (User, error) { return la.fallback.Lookup(username) })
+}
+
+// VerifyPassword 以用户 DN 和密码绑定 LDAP 校验密码
+func (la *LDAPAuthenticator) VerifyPassword(username, password string) (User, error) {
+	// 空密码会被 LDAP 视为匿名绑定而成功，必须拒绝
+	if password == "" {
+		return User{}, ErrInvalidPassword
+	}
+	user, err := la.fetch(username, password, true)
+	return la.orFallback(user, err, func() (User, error) { return la.fallback.VerifyPassword(username, password) })
+}
+
+// List 只列出本地用户，LDAP 用户不参与
+func (la *LDAPAuthenticator) List() ([]User, error) {
+	return la.fallback.List()
+}
+
+// Create 创建本地用户，LDAP 中的用户只能在目录中维护
+func (la *LDAPAuthenticator) Create(user User) error {
+	return la.fallback.Create(user)
+}
+
+// Update 更新本地用户，只存在于 LDAP 的用户返回 ErrUserNotFound
+func (la *LDAPAuthenticator) Update(user User) error {
+	return la.fallback.Update(user)
+}
+
+// Delete 删除本地用户，只存在于 LDAP 的用户返回 ErrUserNotFound
+func (la *LDAPAuthenticator) Delete(username string) error {
+	return la.fallback.Delete(username)
+}
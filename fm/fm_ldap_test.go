@@ -0,0 +1,223 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testLDAPServiceDN       = "cn=svc,dc=example,dc=org"
+	testLDAPServicePassword = "svc-secret"
+)
+
+type fakeLDAPUser struct {
+	dn       string
+	password string
+	groups   []string
+}
+
+// fakeLDAP 内存中的 LDAP 目录，按 (uid=%s) 查找用户，组记录在 memberOf 上
+type fakeLDAP struct {
+	users map[string]fakeLDAPUser
+	down  bool // 为 true 时连接失败
+	dials int
+}
+
+func (f *fakeLDAP) dial() (ldapConn, error) {
+	f.dials++
+	if f.down {
+		return nil, errors.New("connection refused")
+	}
+	return &fakeLDAPConn{dir: f}, nil
+}
+
+type fakeLDAPConn struct {
+	dir *fakeLDAP
+}
+
+func (c *fakeLDAPConn) Bind(username, password string) error {
+	if username == testLDAPServiceDN && password == testLDAPServicePassword {
+		return nil
+	}
+	for _, user := range c.dir.users {
+		if user.dn == username && user.password == password {
+			return nil
+		}
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (c *fakeLDAPConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	uid := strings.TrimSuffix(strings.TrimPrefix(request.Filter, "(uid="), ")")
+	result := &ldap.SearchResult{}
+	if user, ok := c.dir.users[uid]; ok {
+		result.Entries = append(result.Entries, ldap.NewEntry(user.dn, map[string][]string{"memberOf": user.groups}))
+	}
+	return result, nil
+}
+
+func (c *fakeLDAPConn) Close() error {
+	return nil
+}
+
+// 创建使用内存目录的 LDAP 认证，本地用户 local 的密码为 local-secret
+func newTestLDAP(t *testing.T) (*LDAPAuthenticator, *fakeLDAP) {
+	t.Helper()
+	dir := &fakeLDAP{users: map[string]fakeLDAPUser{
+		"alice": {dn: "uid=alice,ou=people,dc=example,dc=org", password: "alice-secret", groups: []string{"cn=Admins,ou=groups,dc=example,dc=org"}},
+		"bob":   {dn: "uid=bob,ou=people,dc=example,dc=org", password: "bob-secret", groups: []string{"cn=devs,ou=groups,dc=example,dc=org"}},
+		"carol": {dn: "uid=carol,ou=people,dc=example,dc=org", password: "carol-secret", groups: []string{"cn=others,ou=groups,dc=example,dc=org"}},
+	}}
+	fallback, err := NewFileUserStore(filepath.Join(t.TempDir(), "users.yaml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fallback.Create(User{Username: "local", EncryptPassword: DefaultHashPassword("local-secret")}); err != nil {
+		t.Fatal(err)
+	}
+	la, err := NewLDAPAuthenticator(LDAPConfig{
+		URL:          "ldap://ldap.example.org:389",
+		BindDN:       testLDAPServiceDN,
+		BindPassword: testLDAPServicePassword,
+		BaseDN:       "dc=example,dc=org",
+		Groups: []GroupMapping{
+			{Group: "admins", Role: "admin"},
+			{Group: "cn=devs,ou=groups,dc=example,dc=org", Permissions: []string{PermissionDirUpload}, PathRestrictions: []string{"/projects"}},
+		},
+	}, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	la.dial = dir.dial
+	return la, dir
+}
+
+// 组名按 CN 或完整 DN 匹配，未映射到任何组的用户交给本地用户
+func TestLDAPGroupMapping(t *testing.T) {
+	la, _ := newTestLDAP(t)
+
+	alice, err := la.VerifyPassword("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alice.Roles) != 1 || alice.Roles[0] != "admin" {
+		t.Errorf("alice roles = %v, want [admin]", alice.Roles)
+	}
+
+	bob, err := la.VerifyPassword("bob", "bob-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bob.Permissions[PermissionDirUpload] || len(bob.BaseRolePathRestrictions) != 1 || bob.BaseRolePathRestrictions[0] != "/projects" {
+		t.Errorf("bob = %+v, want dir:upload restricted to /projects", bob)
+	}
+
+	if _, err = la.VerifyPassword("carol", "carol-secret"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("carol err = %v, want ErrUserNotFound", err)
+	}
+}
+
+// 密码错误时不尝试本地用户，用户不存在或 LDAP 不可用时交给本地用户
+func TestLDAPFallback(t *testing.T) {
+	la, dir := newTestLDAP(t)
+
+	if _, err := la.VerifyPassword("alice", "wrong"); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("wrong password err = %v, want ErrInvalidPassword", err)
+	}
+	if user, err := la.VerifyPassword("local", "local-secret"); err != nil || user.Username != "local" {
+		t.Errorf("local user = %+v, %v", user, err)
+	}
+
+	dir.down = true
+	if user, err := la.VerifyPassword("local", "local-secret"); err != nil || user.Username != "local" {
+		t.Errorf("local user with LDAP down = %+v, %v", user, err)
+	}
+	// 本地也不存在时返回 LDAP 的错误
+	if _, err := la.VerifyPassword("alice", "alice-secret"); err == nil || errors.Is(err, ErrUserNotFound) {
+		t.Errorf("alice with LDAP down err = %v, want connection error", err)
+	}
+
+	// 用户的增删改由本地用户存储处理
+	if err := la.Create(User{Username: "dave", EncryptPassword: DefaultHashPassword("dave-secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := la.fallback.Lookup("dave"); err != nil {
+		t.Errorf("created user not in fallback: %v", err)
+	}
+	if err := la.Update(User{Username: "alice"}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("update LDAP-only user err = %v, want ErrUserNotFound", err)
+	}
+	if err := la.Delete("dave"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 缓存有效期内不访问 LDAP，过期后重新查询，LDAP 不可用时继续使用过期的缓存
+func TestLDAPCacheTTL(t *testing.T) {
+	la, dir := newTestLDAP(t)
+
+	if _, err := la.Lookup("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := la.Lookup("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if dir.dials != 1 {
+		t.Errorf("dials = %d, want 1 while cached", dir.dials)
+	}
+
+	expire := func() {
+		la.mu.Lock()
+		entry := la.cache["bob"]
+		entry.expires = time.Now().Add(-time.Second)
+		la.cache["bob"] = entry
+		la.mu.Unlock()
+	}
+
+	expire()
+	dir.users["bob"] = fakeLDAPUser{dn: "uid=bob,ou=people,dc=example,dc=org", groups: []string{"cn=admins,ou=groups,dc=example,dc=org"}}
+	user, err := la.Lookup("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.dials != 2 || len(user.Roles) != 1 || user.Roles[0] != "admin" {
+		t.Errorf("after expiry dials = %d roles = %v, want refetched admin", dir.dials, user.Roles)
+	}
+
+	expire()
+	dir.down = true
+	if user, err = la.Lookup("bob"); err != nil || len(user.Roles) != 1 {
+		t.Errorf("stale cache with LDAP down = %+v, %v", user, err)
+	}
+
+	// 用户从目录中删除后清除缓存
+	dir.down = false
+	expire()
+	delete(dir.users, "bob")
+	if _, err = la.Lookup("bob"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("removed user err = %v, want ErrUserNotFound", err)
+	}
+	la.mu.Lock()
+	_, cached := la.cache["bob"]
+	la.mu.Unlock()
+	if cached {
+		t.Error("removed user still cached")
+	}
+}
+
+// 空密码会被 LDAP 当作匿名绑定，必须在连接前拒绝
+func TestLDAPEmptyPassword(t *testing.T) {
+	la, dir := newTestLDAP(t)
+	if _, err := la.VerifyPassword("alice", ""); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("empty password err = %v, want ErrInvalidPassword", err)
+	}
+	if dir.dials != 0 {
+		t.Errorf("dials = %d, want 0", dir.dials)
+	}
+}
@@ -0,0 +1,176 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 清理过期登录记录的间隔
+const loginLimitPruneInterval = time.Minute
+
+// LoginLimitConfig 登录失败限制，账户每次失败后按指数退避，连续失败达到上限后账户或 IP 被临时锁定
+type LoginLimitConfig struct {
+	MaxFailures     int      `json:"max_failures"     yaml:"max_failures"     toml:"max_failures"`     // 同一账户连续失败次数上限，0 表示不限制
+	IPMaxFailures   int      `json:"ip_max_failures"  yaml:"ip_max_failures"  toml:"ip_max_failures"`  // 同一 IP 失败次数上限，0 表示不限制
+	BaseDelay       Duration `json:"base_delay"       yaml:"base_delay"       toml:"base_delay"`       // 账户第一次失败后的等待时间，之后每次翻倍
+	MaxDelay        Duration `json:"max_delay"        yaml:"max_delay"        toml:"max_delay"`        // 退避等待时间上限
+	LockoutDuration Duration `json:"lockout_duration" yaml:"lockout_duration" toml:"lockout_duration"` // 锁定时长，也是失败计数的有效期
+}
+
+// DefaultLoginLimitConfig 默认登录失败限制
+func DefaultLoginLimitConfig() LoginLimitConfig {
+	return LoginLimitConfig{
+		MaxFailures:     5,
+		IPMaxFailures:   20,
+		BaseDelay:       Duration(time.Second),
+		MaxDelay:        Duration(time.Minute),
+		LockoutDuration: Duration(15 * time.Minute),
+	}
+}
+
+// Validate 校验登录失败限制
+func (lc LoginLimitConfig) Validate() error {
+	var errs []error
+	if lc.MaxFailures < 0 {
+		errs = append(errs, fmt.Errorf("login_limit.max_failures: 不能为负数"))
+	}
+	if lc.IPMaxFailures < 0 {
+		errs = append(errs, fmt.Errorf("login_limit.ip_max_failures: 不能为负数"))
+	}
+	if lc.BaseDelay < 0 {
+		errs = append(errs, fmt.Errorf("login_limit.base_delay: 不能为负数"))
+	}
+	if lc.MaxDelay < 0 {
+		errs = append(errs, fmt.Errorf("login_limit.max_delay: 不能为负数"))
+	}
+	if lc.LockoutDuration <= 0 && (lc.MaxFailures > 0 || lc.IPMaxFailures > 0) {
+		errs = append(errs, fmt.Errorf("login_limit.lockout_duration: 启用锁定时必须大于 0"))
+	}
+	return errors.Join(errs...)
+}
+
+type loginAttempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// loginLimiter 按账户和 IP 记录登录失败次数
+type loginLimiter struct {
+	mu        sync.Mutex
+	config    LoginLimitConfig
+	attempts  map[string]*loginAttempts
+	lastPrune time.Time
+}
+
+func newLoginLimiter(config LoginLimitConfig) *loginLimiter {
+	return &loginLimiter{
+		config:   config,
+		attempts: map[string]*loginAttempts{},
+	}
+}
+
+// 账户名不区分大小写，避免通过改变大小写绕过限制
+func accountKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// 返回当前是否允许登录，不允许时返回需要等待的时长
+func (ll *loginLimiter) allow(ip, username string) (time.Duration, bool) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+
+	now := time.Now()
+	ll.prune(now)
+	var wait time.Duration
+	for _, key := range []string{ipKey(ip), accountKey(username)} {
+		if attempts, ok := ll.attempts[key]; ok && now.Before(attempts.blockedUntil) {
+			wait = max(wait, attempts.blockedUntil.Sub(now))
+		}
+	}
+	return wait, wait == 0
+}
+
+// 记录一次失败，返回本次失败是否触发了锁定
+func (ll *loginLimiter) fail(ip, username string) (locked bool) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+
+	now := time.Now()
+	lockout := time.Duration(ll.config.LockoutDuration)
+
+	account := ll.record(accountKey(username), now)
+	if ll.config.MaxFailures > 0 && account.failures >= ll.config.MaxFailures {
+		account.blockedUntil = now.Add(lockout)
+		locked = account.failures == ll.config.MaxFailures
+	} else if ll.config.BaseDelay > 0 {
+		// 第 n 次失败后等待 BaseDelay * 2^(n-1)，不超过 MaxDelay
+		delay := float64(ll.config.BaseDelay) * math.Pow(2, float64(account.failures-1))
+		if ll.config.MaxDelay > 0 {
+			delay = math.Min(delay, float64(ll.config.MaxDelay))
+		}
+		account.blockedUntil = now.Add(time.Duration(delay))
+	}
+
+	address := ll.record(ipKey(ip), now)
+	if ll.config.IPMaxFailures > 0 && address.failures >= ll.config.IPMaxFailures {
+		address.blockedUntil = now.Add(lockout)
+		locked = locked || address.failures == ll.config.IPMaxFailures
+	}
+	return locked
+}
+
+// 累加失败次数，上次失败超过锁定时长后重新计数，调用方需持有锁
+func (ll *loginLimiter) record(key string, now time.Time) *loginAttempts {
+	attempts, ok := ll.attempts[key]
+	if !ok || now.Sub(attempts.lastFailure) > time.Duration(ll.config.LockoutDuration) {
+		attempts = &loginAttempts{}
+		ll.attempts[key] = attempts
+	}
+	attempts.failures++
+	attempts.lastFailure = now
+	return attempts
+}
+
+// 登录成功后清除账户的失败记录，IP 的记录保留，避免攻击者用自己的账户重置计数
+func (ll *loginLimiter) succeed(username string) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	delete(ll.attempts, accountKey(username))
+}
+
+// 删除已过期的记录，调用方需持有锁
+func (ll *loginLimiter) prune(now time.Time) {
+	if now.Sub(ll.lastPrune) < loginLimitPruneInterval {
+		return
+	}
+	ll.lastPrune = now
+	for key, attempts := range ll.attempts {
+		if now.After(attempts.blockedUntil) && now.Sub(attempts.lastFailure) > time.Duration(ll.config.LockoutDuration) {
+			delete(ll.attempts, key)
+		}
+	}
+}
+
+// 告知客户端需要等待的秒数
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// SetLoginLimit 设置登录失败限制
+func (fm *FileManager) SetLoginLimit(config LoginLimitConfig) *FileManager {
+	fm.loginLimiter = newLoginLimiter(config)
+	return fm
+}
@@ -0,0 +1,72 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"testing"
+	"time"
+)
+
+// 账户每次失败后等待时间翻倍且不超过上限，达到失败次数上限后锁定
+func TestLoginLimiterBackoff(t *testing.T) {
+	ll := newLoginLimiter(LoginLimitConfig{
+		MaxFailures:     5,
+		BaseDelay:       Duration(time.Second),
+		MaxDelay:        Duration(4 * time.Second),
+		LockoutDuration: Duration(15 * time.Minute),
+	})
+	tests := []struct {
+		wait   time.Duration
+		locked bool
+	}{
+		{time.Second, false},
+		{2 * time.Second, false},
+		{4 * time.Second, false},
+		{4 * time.Second, false},
+		{15 * time.Minute, true},
+		{15 * time.Minute, false},
+	}
+	for i, tt := range tests {
+		// 用户名不区分大小写
+		username := "alice"
+		if i%2 == 1 {
+			username = "Alice"
+		}
+		if locked := ll.fail("10.0.0.1", username); locked != tt.locked {
+			t.Errorf("failure %d: locked = %v, want %v", i+1, locked, tt.locked)
+		}
+		wait, ok := ll.allow("10.0.0.2", "alice")
+		if ok || wait > tt.wait || wait < tt.wait-time.Second {
+			t.Errorf("failure %d: allow = %v, %v, want wait about %v", i+1, wait, ok, tt.wait)
+		}
+	}
+	if _, ok := ll.allow("10.0.0.2", "bob"); !ok {
+		t.Error("other account is blocked")
+	}
+}
+
+// 同一 IP 的失败次数达到上限后锁定该 IP 的所有账户，登录成功只清除账户的记录
+func TestLoginLimiterIPLockout(t *testing.T) {
+	ll := newLoginLimiter(LoginLimitConfig{IPMaxFailures: 3, LockoutDuration: Duration(time.Minute)})
+	for i, username := range []string{"alice", "bob", "carol"} {
+		if locked := ll.fail("10.0.0.1", username); locked != (i == 2) {
+			t.Errorf("failure %d: locked = %v", i+1, locked)
+		}
+	}
+	ll.succeed("alice")
+
+	tests := []struct {
+		ip       string
+		username string
+		allowed  bool
+	}{
+		{"10.0.0.1", "dave", false},
+		{"10.0.0.1", "alice", false},
+		{"10.0.0.2", "alice", true},
+		{"10.0.0.2", "bob", true},
+	}
+	for _, tt := range tests {
+		if _, ok := ll.allow(tt.ip, tt.username); ok != tt.allowed {
+			t.Errorf("allow(%s, %s) = %v, want %v", tt.ip, tt.username, ok, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serviceMode 运行时可切换的全局只读和维护模式，重启后恢复为配置中的值
+type serviceMode struct {
+	mu          sync.RWMutex
+	readOnly    bool   // 全局只读，所有用户(包括管理员)都不能上传、编辑、新建、删除和重命名
+	maintenance bool   // 维护模式，非管理员只能看到维护页面
+	message     string // 维护页面显示的说明，为空时使用默认提示
+}
+
+func (m *serviceMode) isReadOnly() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.readOnly
+}
+
+func (m *serviceMode) setReadOnly(readOnly bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readOnly = readOnly
+}
+
+// 维护模式是否开启及说明
+func (m *serviceMode) maintenanceMessage() (bool, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.maintenance, m.message
+}
+
+func (m *serviceMode) setMaintenance(enabled bool, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maintenance, m.message = enabled, message
+}
+
+// SetReadOnly 设置全局只读，运行时同样可以在 /file/admin/mode 中切换
+func (fm *FileManager) SetReadOnly(readOnly bool) *FileManager {
+	fm.mode.setReadOnly(readOnly)
+	return fm
+}
+
+// SetMaintenance 设置维护模式，开启后非管理员的请求只返回维护页面，message 为空时使用默认提示
+func (fm *FileManager) SetMaintenance(enabled bool, message string) *FileManager {
+	fm.mode.setMaintenance(enabled, strings.TrimSpace(message))
+	return fm
+}
+
+// SetMountReadOnly 切换挂载点的只读状态
+func (fm *FileManager) SetMountReadOnly(name string, readOnly bool) *FileManager {
+	if err := fm.setMountReadOnly(name, readOnly); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setMountReadOnly(name string, readOnly bool) error {
+	m, ok := fm.files.mounts[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrMountNotFound, name)
+	}
+	m.readOnly.Store(readOnly)
+	return nil
+}
+
+// 路径不能修改的原因，返回消息键，可以修改时为空。全局只读优先于挂载点的只读
+func (fm *FileManager) readOnlyReason(root *rootFS, paths ...string) string {
+	if fm.mode.isReadOnly() {
+		return "perm.read_only_mode"
+	}
+	for _, p := range paths {
+		if root.isReadOnly(p) {
+			return "perm.read_only"
+		}
+	}
+	return ""
+}
+
+// 页面顶部的提示，全局只读时所有用户可见，维护模式只对管理员显示(其他用户只能看到维护页面)
+func (fm *FileManager) modeBanner(c *gin.Context, user User) string {
+	if maintenance, _ := fm.mode.maintenanceMessage(); maintenance && user.IsAdmin() {
+		return fm.t(c, "mode.maintenance_banner")
+	}
+	if fm.mode.isReadOnly() {
+		return fm.t(c, "mode.read_only_banner")
+	}
+	return ""
+}
+
+// 维护页面
+type maintenancePageData struct {
+	pageData
+	Message string
+}
+
+// 维护模式下非管理员的请求返回 503 和维护页面，JSON 请求返回 {"code","error"}
+func (fm *FileManager) maintenanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maintenance, message := fm.mode.maintenanceMessage()
+		value, _ := c.Get("user")
+		user, ok := value.(User)
+		if !ok {
+			user = fm.guest()
+		}
+		if !maintenance || user.IsAdmin() {
+			c.Next()
+			return
+		}
+		if message == "" {
+			message = fm.t(c, "mode.maintenance_default")
+		}
+
+		c.Header("Retry-After", "300")
+		switch {
+		case wantsJSON(c):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"code": "mode.maintenance", "error": message})
+		case strings.Contains(c.GetHeader("Accept"), "text/html"):
+			fm.renderHTML(c, http.StatusServiceUnavailable, templateMaintenance, maintenancePageData{
+				pageData: fm.newPageData(c, user),
+				Message:  message,
+			})
+		default:
+			c.String(http.StatusServiceUnavailable, message)
+		}
+		c.Abort()
+	}
+}
+
+// 运行模式的当前状态，管理页面和 JSON 接口共用
+type modeState struct {
+	ReadOnly           bool            `json:"read_only"`
+	Maintenance        bool            `json:"maintenance"`
+	MaintenanceMessage string          `json:"maintenance_message"`
+	Mounts             map[string]bool `json:"mounts,omitempty"` // 挂载点名称 -> 是否只读
+}
+
+func (fm *FileManager) modeState() modeState {
+	state := modeState{ReadOnly: fm.mode.isReadOnly()}
+	state.Maintenance, state.MaintenanceMessage = fm.mode.maintenanceMessage()
+	if len(fm.files.mounts) > 0 {
+		state.Mounts = make(map[string]bool, len(fm.files.mounts))
+		for name, m := range fm.files.mounts {
+			state.Mounts[name] = m.readOnly.Load()
+		}
+	}
+	return state
+}
+
+// 运行模式管理页面
+type modePageData struct {
+	pageData
+	State  modeState
+	Mounts []string
+}
+
+// 管理员查看运行模式，JSON 请求返回当前状态
+func (fm *FileManager) showAdminMode(c *gin.Context) {
+	state := fm.modeState()
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, state)
+		return
+	}
+	user, _ := fm.currentUser(c)
+	fm.renderHTML(c, http.StatusOK, templateAdminMode, modePageData{
+		pageData: fm.newPageData(c, user),
+		State:    state,
+		Mounts:   slices.Sorted(maps.Keys(state.Mounts)),
+	})
+}
+
+// 管理员切换运行模式，只修改提交了的参数：
+// read_only=true|false 切换全局只读，同时提交 mount 时只切换该挂载点；maintenance=true|false 和 message 切换维护模式
+func (fm *FileManager) handleAdminMode(c *gin.Context) {
+	parseBool := func(name string) (value, ok bool, err error) {
+		raw, ok := c.GetPostForm(name)
+		if !ok {
+			return false, false, nil
+		}
+		value, err = strconv.ParseBool(raw)
+		return value, true, err
+	}
+
+	readOnly, setReadOnly, err := parseBool("read_only")
+	if err != nil {
+		fm.respondError(c, http.StatusBadRequest, "mode.bad_value", "read_only")
+		return
+	}
+	maintenance, setMaintenance, err := parseBool("maintenance")
+	if err != nil {
+		fm.respondError(c, http.StatusBadRequest, "mode.bad_value", "maintenance")
+		return
+	}
+
+	if setReadOnly {
+		if mount := c.PostForm("mount"); mount != "" {
+			if err = fm.setMountReadOnly(mount, readOnly); err != nil {
+				fm.respondError(c, http.StatusNotFound, "mode.mount_not_found", mount)
+				return
+			}
+			fm.audit(c, AuditModeChanged, "mount", mount, "read_only", readOnly)
+		} else {
+			fm.mode.setReadOnly(readOnly)
+			fm.audit(c, AuditModeChanged, "read_only", readOnly)
+		}
+	}
+	if setMaintenance {
+		message := strings.TrimSpace(c.PostForm("message"))
+		fm.mode.setMaintenance(maintenance, message)
+		fm.audit(c, AuditModeChanged, "maintenance", maintenance, "message", message)
+	}
+
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, fm.modeState())
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/file/admin/mode")
+}
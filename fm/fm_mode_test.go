@@ -0,0 +1,92 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 全局只读对管理员同样生效，挂载点只读只影响该挂载点，维护模式只放行管理员和登录页面
+func TestModeGating(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "work/a.txt", "logs/app.log")
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetMounts(map[string]MountConfig{
+		"work": {Dir: filepath.Join(dir, "work")},
+		"logs": {Dir: filepath.Join(dir, "logs")},
+	}).SetUsers(map[string]User{
+		"admin": {Username: "admin", EncryptPassword: DefaultHashPassword("secret"), Roles: []string{RoleAdmin}},
+		"alice": {
+			Username:                 "alice",
+			EncryptPassword:          DefaultHashPassword("secret"),
+			Permissions:              map[string]bool{PermissionDirView: true, PermissionFileView: true, PermissionDirCreate: true},
+			BaseRolePathRestrictions: []string{"/"},
+		},
+	})
+	engine := fm.engine()
+	cookies := map[string][]*http.Cookie{
+		"admin": testLogin(t, engine, "admin", "secret"),
+		"alice": testLogin(t, engine, "alice", "secret"),
+	}
+	post := func(username, target string, values url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Accept", "application/json")
+		for _, cookie := range cookies[username] {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder
+	}
+	setMode := func(values url.Values) {
+		t.Helper()
+		if recorder := post("admin", "/file/admin/mode", values); recorder.Code != http.StatusOK {
+			t.Fatalf("set mode %v = %d %s", values, recorder.Code, recorder.Body)
+		}
+	}
+	mkdir := func(username, path string) int {
+		return post(username, "/file/action", url.Values{"action": {"create"}, "path": {path}, "name": {"new"}, "is_dir": {"true"}}).Code
+	}
+	get := func(username, target string) int {
+		return serveTest(engine, http.MethodGet, target, cookies[username]).Code
+	}
+
+	if code := post("alice", "/file/admin/mode", url.Values{"read_only": {"true"}}).Code; code != http.StatusForbidden {
+		t.Errorf("non-admin changed the mode: %d", code)
+	}
+
+	tests := []struct {
+		name   string
+		mode   url.Values
+		check  func() int
+		status int
+	}{
+		{"writable", nil, func() int { return mkdir("alice", "work") }, http.StatusSeeOther},
+		{"global read-only blocks users", url.Values{"read_only": {"true"}}, func() int { return mkdir("alice", "logs") }, http.StatusForbidden},
+		{"global read-only blocks admin", nil, func() int { return mkdir("admin", "logs") }, http.StatusForbidden},
+		{"global read-only allows browsing", nil, func() int { return get("alice", "/file?path=work") }, http.StatusOK},
+		{"global read-only off", url.Values{"read_only": {"false"}}, func() int { return mkdir("alice", "logs") }, http.StatusSeeOther},
+		{"mount read-only blocks the mount", url.Values{"read_only": {"true"}, "mount": {"logs"}}, func() int { return mkdir("admin", "logs/new") }, http.StatusForbidden},
+		{"mount read-only leaves other mounts", nil, func() int { return mkdir("alice", "work/new") }, http.StatusSeeOther},
+		{"maintenance blocks users", url.Values{"maintenance": {"true"}, "message": {"back soon"}}, func() int { return get("alice", "/file") }, http.StatusServiceUnavailable},
+		{"maintenance allows admin", nil, func() int { return get("admin", "/file") }, http.StatusOK},
+		{"maintenance allows login page", nil, func() int { return get("", "/file/login") }, http.StatusOK},
+		{"maintenance off", url.Values{"maintenance": {"false"}}, func() int { return get("alice", "/file") }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if tt.mode != nil {
+			setMode(tt.mode)
+		}
+		if got := tt.check(); got != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.status)
+		}
+	}
+}
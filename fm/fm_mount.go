@@ -0,0 +1,174 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrMountNotFound = errors.New("挂载点不存在")
+	ErrCrossMount    = errors.New("不能在挂载点之间移动")
+)
+
+// MountConfig 挂载点，以名称作为路径的第一段，如 /logs/app.log
+type MountConfig struct {
+	Dir           string   `json:"dir"                       yaml:"dir"                       toml:"dir"`
+	ReadOnly      bool     `json:"read_only,omitempty"       yaml:"read_only,omitempty"       toml:"read_only,omitempty"`       // 只读，管理员同样不能修改
+	MaxUploadSize int64    `json:"max_upload_size,omitempty" yaml:"max_upload_size,omitempty" toml:"max_upload_size,omitempty"` // 上传大小限制，0 表示使用全局的 max_upload_size
+	Permissions   []string `json:"permissions,omitempty"     yaml:"permissions,omitempty"     toml:"permissions,omitempty"`     // 挂载点中最多可用的权限，与用户的全局权限取交集，acl 仍然优先
+}
+
+// 挂载点名称能否作为路径的一段
+func validMountName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\*?[]!")
+}
+
+// 校验挂载点
+func validateMounts(mounts map[string]MountConfig) []error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(mounts)) {
+		field := "mounts." + name
+		if !validMountName(name) {
+			errs = append(errs, fmt.Errorf("%s: 名称不能为空且不能包含 / \\ * ? [ ] !", field))
+		}
+		mount := mounts[name]
+		if mount.Dir == "" {
+			errs = append(errs, fmt.Errorf("%s.dir: 不能为空", field))
+		} else if info, err := os.Stat(mount.Dir); err != nil {
+			errs = append(errs, fmt.Errorf("%s.dir: %v", field, err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Errorf("%s.dir: %s 不是目录", field, mount.Dir))
+		}
+		if mount.MaxUploadSize < 0 {
+			errs = append(errs, fmt.Errorf("%s.max_upload_size: 不能小于 0", field))
+		}
+		for _, permission := range mount.Permissions {
+			if !IsValidPermission(permission) {
+				errs = append(errs, fmt.Errorf("%s.permissions: 未知权限 %q", field, permission))
+			}
+		}
+	}
+	return errs
+}
+
+// 挂载点列表，根目录只列出挂载点
+func newMountTable(mounts map[string]MountConfig, policy string) *rootFS {
+	table := &rootFS{policy: policy, readOnly: new(atomic.Bool), mounts: make(map[string]*rootFS, len(mounts))}
+	for name, mount := range mounts {
+		m := newRootFS(mount.Dir)
+		m.policy, m.maxUpload = policy, mount.MaxUploadSize
+		m.readOnly.Store(mount.ReadOnly)
+		table.mounts[name] = m
+	}
+	return table
+}
+
+// 挂载点的默认权限，转换为挂载点路径上拒绝未列出权限的规则，只能收窄用户的权限，不会授予用户没有的权限
+func mountDefaults(mounts map[string]MountConfig) []ACLRule {
+	var rules []ACLRule
+	for _, name := range slices.Sorted(maps.Keys(mounts)) {
+		mount := mounts[name]
+		if len(mount.Permissions) == 0 {
+			continue
+		}
+		rule := ACLRule{Path: "/" + name}
+		for _, permission := range AllPermissions {
+			if !slices.Contains(mount.Permissions, permission) {
+				rule.Deny = append(rule.Deny, permission)
+			}
+		}
+		if len(rule.Deny) > 0 {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// 规范路径所在的挂载点和挂载点内的路径
+func (r *rootFS) mountOf(rel string) (*rootFS, string, error) {
+	name, sub, _ := strings.Cut(rel, "/")
+	m, ok := r.mounts[name]
+	if !ok {
+		return nil, "", ErrMountNotFound
+	}
+	return m, sub, nil
+}
+
+// 按挂载点解析路径，第一段为挂载点名称
+func (r *rootFS) resolveMount(segments []string) (string, error) {
+	if len(segments) == 0 {
+		return "", nil
+	}
+	m, ok := r.mounts[segments[0]]
+	if !ok {
+		return "", ErrMountNotFound
+	}
+	sub, err := m.resolve(strings.Join(segments[1:], "/"))
+	if err != nil || sub == "" {
+		return segments[0], err
+	}
+	return segments[0] + "/" + sub, nil
+}
+
+// 挂载点列表中的条目，名称为挂载点名称
+type mountEntryInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i mountEntryInfo) Name() string {
+	return i.name
+}
+
+// 按名称排序的挂载点
+func (r *rootFS) mountEntries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(r.mounts))
+	for _, name := range slices.Sorted(maps.Keys(r.mounts)) {
+		var info fs.FileInfo = mountTableInfo{}
+		if stat, err := r.mounts[name].Stat(""); err == nil {
+			info = stat
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(mountEntryInfo{FileInfo: info, name: name}))
+	}
+	return entries
+}
+
+// 挂载点列表本身，显示为只读目录
+type mountTableInfo struct{}
+
+func (mountTableInfo) Name() string       { return "/" }
+func (mountTableInfo) Size() int64        { return 0 }
+func (mountTableInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (mountTableInfo) ModTime() time.Time { return time.Time{} }
+func (mountTableInfo) IsDir() bool        { return true }
+func (mountTableInfo) Sys() any           { return nil }
+
+// SetMounts 挂载多个目录，路径的第一段为挂载点名称，设置后不再使用创建时的根目录，mounts 为空时不修改
+func (fm *FileManager) SetMounts(mounts map[string]MountConfig) *FileManager {
+	if err := fm.setMounts(mounts); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setMounts(mounts map[string]MountConfig) error {
+	if len(mounts) == 0 {
+		return nil
+	}
+	if err := errors.Join(validateMounts(mounts)...); err != nil {
+		return err
+	}
+	if err := fm.roles.setDefaults(mountDefaults(mounts)); err != nil {
+		return err
+	}
+	fm.files = newMountTable(mounts, fm.files.policy)
+	return nil
+}
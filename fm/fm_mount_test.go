@@ -0,0 +1,172 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func newTestMountManager(t *testing.T) *FileManager {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "scratch/a.txt", "releases/v1.zip", "plain/b.txt")
+	return NewFileManager(t.TempDir(), zap.NewNop()).SetMounts(map[string]MountConfig{
+		"scratch":  {Dir: filepath.Join(dir, "scratch"), Permissions: []string{PermissionDirView, PermissionFileView, PermissionFileEdit, PermissionFileDelete}},
+		"releases": {Dir: filepath.Join(dir, "releases"), Permissions: []string{PermissionDirView}},
+		"plain":    {Dir: filepath.Join(dir, "plain")},
+	})
+}
+
+// 第一段为挂载点名称，其余部分映射到挂载点目录中，根目录只列出挂载点
+func TestMountPathMapping(t *testing.T) {
+	files := newTestMountManager(t).files
+	tests := []struct {
+		path     string
+		resolved string
+		content  string
+		err      error
+	}{
+		{"scratch/a.txt", "scratch/a.txt", "scratch/a.txt", nil},
+		{"/releases/v1.zip", "releases/v1.zip", "releases/v1.zip", nil},
+		{"scratch/../plain/b.txt", "plain/b.txt", "plain/b.txt", nil},
+		{"plain", "plain", "", nil},
+		{"unknown/a.txt", "", "", ErrMountNotFound},
+	}
+	for _, tt := range tests {
+		resolved, err := files.resolve(tt.path)
+		if resolved != tt.resolved || !errors.Is(err, tt.err) {
+			t.Errorf("resolve(%q) = %q, %v, want %q, %v", tt.path, resolved, err, tt.resolved, tt.err)
+			continue
+		}
+		if tt.content == "" {
+			continue
+		}
+		if data, err := files.ReadFile(resolved); err != nil || string(data) != tt.content {
+			t.Errorf("ReadFile(%q) = %q, %v, want %q", resolved, data, err, tt.content)
+		}
+	}
+	if _, err := files.resolve("../outside"); err == nil {
+		t.Error("path outside the mount table resolved")
+	}
+
+	entries, err := files.ReadDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, []string{"plain", "releases", "scratch"}) {
+		t.Errorf("root entries = %v, want the mount names", names)
+	}
+}
+
+// 挂载点的默认权限与用户的全局权限取交集，只能收窄，游客不会因此获得修改权限
+func TestMountDefaultsNarrowOnly(t *testing.T) {
+	fm := newTestMountManager(t)
+	guest := fm.guest()
+	editor := fm.resolveUser(User{
+		Username:    "editor",
+		Permissions: map[string]bool{PermissionDirView: true, PermissionFileView: true, PermissionFileEdit: true},
+	})
+	granted := fm.resolveUser(User{
+		Username:    "granted",
+		Permissions: map[string]bool{PermissionDirView: true},
+		ACL:         []ACLRule{{Path: "/releases", Allow: []string{PermissionFileView}}},
+	})
+
+	tests := []struct {
+		name       string
+		user       User
+		permission string
+		path       string
+		want       bool
+	}{
+		{"guest edit in editable mount", guest, PermissionFileEdit, "scratch/a.txt", false},
+		{"guest delete in editable mount", guest, PermissionFileDelete, "scratch/a.txt", false},
+		{"guest view in editable mount", guest, PermissionFileView, "scratch/a.txt", true},
+		{"guest view in list-only mount", guest, PermissionFileView, "releases/v1.zip", false},
+		{"guest view in mount without defaults", guest, PermissionFileView, "plain/b.txt", true},
+		{"editor edit in editable mount", editor, PermissionFileEdit, "scratch/a.txt", true},
+		{"editor edit in list-only mount", editor, PermissionFileEdit, "releases/v1.zip", false},
+		{"acl allow overrides mount defaults", granted, PermissionFileView, "releases/v1.zip", true},
+	}
+	for _, tt := range tests {
+		if got := tt.user.Can(tt.permission, tt.path); got != tt.want {
+			t.Errorf("%s: Can(%s, %s) = %v, want %v", tt.name, tt.permission, tt.path, got, tt.want)
+		}
+	}
+	if guest.hasPermissionAnywhere(PermissionFileEdit) {
+		t.Error("guest can choose file:edit for API tokens because of mount defaults")
+	}
+}
+
+// 上传请求按目标挂载点的限制在解析表单前截断，超出时返回 413
+func TestMountUploadLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetMaxUploadSize(1 << 20).SetMounts(map[string]MountConfig{
+		"small": {Dir: dir, MaxUploadSize: 1024},
+	}).SetUsers(map[string]User{
+		"admin": {Username: "admin", EncryptPassword: DefaultHashPassword("secret"), Roles: []string{RoleAdmin}},
+	})
+	engine := fm.engine()
+	cookies := testLogin(t, engine, "admin", "secret")
+
+	upload := func(target string, fields map[string]string, size int) int {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		part, err := writer.CreateFormFile("file", "data.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(strings.Repeat("x", size)))
+		writer.Close()
+		request := httptest.NewRequest(http.MethodPost, target, &body)
+		request.Header.Set("Content-Type", writer.FormDataContentType())
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		fields map[string]string
+		size   int
+		status int
+	}{
+		{"within mount limit", "/file/upload?path=small", nil, 512, http.StatusSeeOther},
+		{"over mount limit", "/file/upload?path=small", nil, 2048, http.StatusRequestEntityTooLarge},
+		{"over mount limit with path in body", "/file/upload", map[string]string{"path": "small"}, 2048, http.StatusRequestEntityTooLarge},
+		{"over global limit with path in body", "/file/upload", map[string]string{"path": "small"}, 3 << 20, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		os.Remove(filepath.Join(dir, "data.bin"))
+		if got := upload(tt.target, tt.fields, tt.size); got != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.status)
+		}
+		_, err := os.Stat(filepath.Join(dir, "data.bin"))
+		if saved := err == nil; saved != (tt.status == http.StatusSeeOther) {
+			t.Errorf("%s: saved = %v", tt.name, saved)
+		}
+	}
+}
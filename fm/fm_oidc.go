@@ -0,0 +1,292 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const (
+	defaultOIDCUsernameClaim = "email"
+	defaultOIDCGroupsClaim   = "groups"
+	oidcFlowMaxAge           = 600 // 登录流程 cookie 的有效期(秒)
+	oidcDiscoveryTimeout     = 10 * time.Second
+)
+
+// OIDCConfig OpenID Connect 单点登录配置
+type OIDCConfig struct {
+	Issuer            string         `json:"issuer"                        yaml:"issuer"                        toml:"issuer"`
+	ClientID          string         `json:"client_id"                     yaml:"client_id"                     toml:"client_id"`
+	ClientSecret      string         `json:"client_secret,omitempty"       yaml:"client_secret,omitempty"       toml:"client_secret,omitempty"` // 公共客户端可以为空，依靠 PKCE 保护
+	RedirectURL       string         `json:"redirect_url"                  yaml:"redirect_url"                  toml:"redirect_url"`            // 如 https://files.example.com/file/login/oidc/callback
+	Scopes            []string       `json:"scopes,omitempty"              yaml:"scopes,omitempty"              toml:"scopes,omitempty"`        // 默认 openid、profile、email
+	UsernameClaim     string         `json:"username_claim,omitempty"      yaml:"username_claim,omitempty"      toml:"username_claim,omitempty"`
+	GroupsClaim       string         `json:"groups_claim,omitempty"        yaml:"groups_claim,omitempty"        toml:"groups_claim,omitempty"`
+	Groups            []GroupMapping `json:"groups,omitempty"              yaml:"groups,omitempty"              toml:"groups,omitempty"`              // 没有本地用户绑定该账户时按组映射权限
+	DisableLocalLogin bool           `json:"disable_local_login,omitempty" yaml:"disable_local_login,omitempty" toml:"disable_local_login,omitempty"` // 登录页直接跳转到 OIDC 提供方
+}
+
+// Validate 校验 OIDC 配置
+func (oc *OIDCConfig) Validate() error {
+	var errs []error
+	if u, err := url.Parse(oc.Issuer); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("oidc.issuer: %q 不是合法的 URL", oc.Issuer))
+	}
+	if oc.ClientID == "" {
+		errs = append(errs, errors.New("oidc.client_id: 不能为空"))
+	}
+	if u, err := url.Parse(oc.RedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("oidc.redirect_url: %q 不是合法的 URL", oc.RedirectURL))
+	}
+	// 没有组映射时只允许绑定了 oidc_subject 的本地用户登录
+	if len(oc.Groups) > 0 {
+		errs = append(errs, validateGroupMappings("oidc.groups", oc.Groups)...)
+	}
+	return errors.Join(errs...)
+}
+
+// oidcProvider 首次登录时才访问提供方的发现文档，提供方暂时不可用不影响启动
+type oidcProvider struct {
+	config OIDCConfig
+
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// SetOIDC 启用 OpenID Connect 单点登录
+func (fm *FileManager) SetOIDC(config OIDCConfig) *FileManager {
+	if err := fm.setOIDC(config); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setOIDC(config OIDCConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = defaultOIDCUsernameClaim
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = defaultOIDCGroupsClaim
+	}
+	fm.oidc = &oidcProvider{config: config}
+	return nil
+}
+
+// 获取提供方配置，发现失败时下次登录重试
+func (op *oidcProvider) client(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.oauth2 != nil {
+		return op.oauth2, op.verifier, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, oidcDiscoveryTimeout)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, op.config.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取 OIDC 提供方配置失败: %v", err)
+	}
+	op.oauth2 = &oauth2.Config{
+		ClientID:     op.config.ClientID,
+		ClientSecret: op.config.ClientSecret,
+		RedirectURL:  op.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       op.config.Scopes,
+	}
+	op.verifier = provider.Verifier(&oidc.Config{ClientID: op.config.ClientID})
+	return op.oauth2, op.verifier, nil
+}
+
+// 按组映射用户，没有匹配的组时返回 false
+func (op *oidcProvider) mapGroups(username string, groups []string) (User, bool) {
+	return mapGroups(username, groups, op.config.Groups, strings.EqualFold)
+}
+
+// 读取字符串或字符串数组形式的 claim
+func claimStrings(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// 查找绑定了 OIDC 账户的本地用户
+func (fm *FileManager) oidcLinkedUser(subject string) (User, bool, error) {
+	users, err := fm.userStore.List()
+	if err != nil {
+		return User{}, false, err
+	}
+	for _, user := range users {
+		if user.OIDCSubject == subject {
+			return user, true, nil
+		}
+	}
+	return User{}, false, nil
+}
+
+// 按 claim 确定用户：设置了 oidc_subject 的本地用户直接使用本地用户，否则按组映射。
+// 本地用户只通过 oidc_subject 关联，不按用户名或邮箱关联，与本地用户同名的映射用户不能登录。
+// 按组映射时同时返回用户的组，保存在会话中，重启或由其他实例处理请求时按组重新映射
+func (fm *FileManager) oidcUserFromClaims(claims map[string]any) (User, []string, error) {
+	config := fm.oidc.config
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return User{}, nil, errors.New("ID token 缺少 sub")
+	}
+	if user, ok, err := fm.oidcLinkedUser(subject); err != nil {
+		return User{}, nil, err
+	} else if ok {
+		return user, nil, nil
+	}
+
+	username, _ := claims[config.UsernameClaim].(string)
+	if username == "" {
+		return User{}, nil, fmt.Errorf("ID token 缺少 %s", config.UsernameClaim)
+	}
+	// 提供方未声明邮箱已验证时，邮箱可能由用户随意填写
+	if config.UsernameClaim == "email" {
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return User{}, nil, fmt.Errorf("邮箱 %s 未验证", username)
+		}
+	}
+	if _, err := fm.userStore.Lookup(username); err == nil {
+		return User{}, nil, fmt.Errorf("本地已存在用户 %s，需要在该用户上设置 oidc_subject: %s 才能通过 OIDC 登录", username, subject)
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return User{}, nil, err
+	}
+
+	groups := claimStrings(claims, config.GroupsClaim)
+	user, ok := fm.oidc.mapGroups(username, groups)
+	if !ok {
+		return User{}, nil, fmt.Errorf("用户 %s 不属于任何已映射的组", username)
+	}
+	return user, groups, nil
+}
+
+// 跳转到 OIDC 提供方
+func (fm *FileManager) handleOIDCLogin(c *gin.Context) {
+	oauth2Config, _, err := fm.oidc.client(c.Request.Context())
+	if err != nil {
+		fm.log.Error(err)
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorSSO)
+		return
+	}
+
+	state, nonce, verifier := rand.Text(), rand.Text(), oauth2.GenerateVerifier()
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     fm.cookieName + "_oidc",
+		Value:    strings.Join([]string{state, nonce, verifier}, "."),
+		Path:     "/file/login/oidc",
+		MaxAge:   oidcFlowMaxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Redirect(http.StatusFound, oauth2Config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)))
+}
+
+// OIDC 回调，校验 state、nonce 后用授权码和 PKCE verifier 换取 ID token
+func (fm *FileManager) handleOIDCCallback(c *gin.Context) {
+	fail := func(format string, args ...any) {
+		fm.log.Warnf("OIDC 登录失败: "+format, args...)
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorSSO)
+	}
+
+	flow, err := c.Cookie(fm.cookieName + "_oidc")
+	http.SetCookie(c.Writer, &http.Cookie{Name: fm.cookieName + "_oidc", Path: "/file/login/oidc", MaxAge: -1})
+	parts := strings.Split(flow, ".")
+	if err != nil || len(parts) != 3 {
+		fail("缺少登录流程 cookie")
+		return
+	}
+	state, nonce, verifier := parts[0], parts[1], parts[2]
+
+	if errCode := c.Query("error"); errCode != "" {
+		fail("提供方返回错误 %s: %s", errCode, c.Query("error_description"))
+		return
+	}
+	if c.Query("state") != state {
+		fail("state 不匹配")
+		return
+	}
+
+	oauth2Config, verifierConfig, err := fm.oidc.client(c.Request.Context())
+	if err != nil {
+		fail("%v", err)
+		return
+	}
+	token, err := oauth2Config.Exchange(c.Request.Context(), c.Query("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		fail("换取 token 失败: %v", err)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		fail("响应中缺少 id_token")
+		return
+	}
+	idToken, err := verifierConfig.Verify(c.Request.Context(), rawIDToken)
+	if err != nil {
+		fail("校验 id_token 失败: %v", err)
+		return
+	}
+	if idToken.Nonce != nonce {
+		fail("nonce 不匹配")
+		return
+	}
+
+	var claims map[string]any
+	if err = idToken.Claims(&claims); err != nil {
+		fail("解析 claims 失败: %v", err)
+		return
+	}
+	user, groups, err := fm.oidcUserFromClaims(claims)
+	if err != nil {
+		fail("%v", err)
+		return
+	}
+
+	if !fm.checkClientIP(c, user) {
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorIP)
+		return
+	}
+	// 绑定的本地用户启用了两步验证时同样需要输入验证码
+	if user.TOTPSecret != "" {
+		fm.startTOTPLogin(c, user.Username, "oidc")
+		return
+	}
+	if err = fm.issueSession(c, user.Username, groups); err != nil {
+		fail("生成JWT token失败: %v", err)
+		return
+	}
+	c.Set("user", user)
+	fm.audit(c, AuditLoginSuccess, "username", user.Username, "method", "oidc")
+	c.Redirect(http.StatusSeeOther, "/file")
+}
@@ -0,0 +1,278 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+func newTestOIDCManager(t *testing.T, issuer string) *FileManager {
+	t.Helper()
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetUsers(map[string]User{
+		"admin": {Username: "admin", Roles: []string{RoleAdmin}},
+		"alice": {Username: "alice", Permissions: map[string]bool{PermissionDirView: true}, OIDCSubject: "alice-sub"},
+		"carol": {Username: "carol", Permissions: map[string]bool{PermissionDirView: true}, OIDCSubject: "carol-sub", TOTPSecret: testTOTPSecret},
+	})
+	if err := fm.setOIDC(OIDCConfig{
+		Issuer:      issuer,
+		ClientID:    "file-manager",
+		RedirectURL: "https://files.example.com/file/login/oidc/callback",
+		Groups:      []GroupMapping{{Group: "engineers", Permissions: []string{PermissionDirView}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return fm
+}
+
+// 本地用户只通过 oidc_subject 关联，邮箱必须已验证，与本地用户同名的映射用户被拒绝
+func TestOIDCUserFromClaims(t *testing.T) {
+	fm := newTestOIDCManager(t, "https://sso.example.com")
+	tests := []struct {
+		name     string
+		claims   map[string]any
+		username string // 为空时期望失败
+	}{
+		{"linked by subject", map[string]any{"sub": "alice-sub", "email": "someone@example.com", "email_verified": true}, "alice"},
+		{"linked without email", map[string]any{"sub": "alice-sub"}, "alice"},
+		{"mapped by group", map[string]any{"sub": "bob-sub", "email": "bob@example.com", "email_verified": true, "groups": []any{"engineers"}}, "bob@example.com"},
+		{"email equals local username", map[string]any{"sub": "evil-sub", "email": "admin", "email_verified": true, "groups": []any{"engineers"}}, ""},
+		{"email not verified", map[string]any{"sub": "bob-sub", "email": "bob@example.com", "email_verified": false, "groups": []any{"engineers"}}, ""},
+		{"email_verified missing", map[string]any{"sub": "bob-sub", "email": "bob@example.com", "groups": []any{"engineers"}}, ""},
+		{"no mapped group", map[string]any{"sub": "bob-sub", "email": "bob@example.com", "email_verified": true, "groups": []any{"sales"}}, ""},
+		{"missing sub", map[string]any{"email": "bob@example.com", "email_verified": true, "groups": []any{"engineers"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, _, err := fm.oidcUserFromClaims(tt.claims)
+			if tt.username == "" {
+				if err == nil {
+					t.Fatalf("got user %s, want error", user.Username)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Username != tt.username {
+				t.Errorf("username = %s, want %s", user.Username, tt.username)
+			}
+		})
+	}
+}
+
+// mockOIDCProvider 提供发现文档、JWKS 和 token 接口的 OIDC 提供方，token 接口按 claims 签发 ID token
+type mockOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	claims jwt.MapClaims
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockOIDCProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		claims := jwt.MapClaims{
+			"iss": p.server.URL,
+			"aud": "file-manager",
+			"iat": time.Now().Unix(),
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for name, value := range p.claims {
+			claims[name] = value
+		}
+		p.mu.Unlock()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *mockOIDCProvider) setClaims(claims jwt.MapClaims) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = claims
+}
+
+func serveTest(handler http.Handler, method, target string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, nil)
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// 完成一次 OIDC 登录，返回会话 cookie
+func oidcLogin(t *testing.T, engine http.Handler, provider *mockOIDCProvider, claims jwt.MapClaims) []*http.Cookie {
+	t.Helper()
+	callback := oidcCallback(t, engine, provider, claims)
+	if callback.Code != http.StatusSeeOther || callback.Header().Get("Location") != "/file" {
+		t.Fatalf("callback = %d %s, want 303 /file", callback.Code, callback.Header().Get("Location"))
+	}
+	return callback.Result().Cookies()
+}
+
+// 从 /file/login/oidc 开始登录，提供方按 claims 签发 ID token，返回回调的响应
+func oidcCallback(t *testing.T, engine http.Handler, provider *mockOIDCProvider, claims jwt.MapClaims) *httptest.ResponseRecorder {
+	t.Helper()
+	start := serveTest(engine, http.MethodGet, "/file/login/oidc", nil)
+	if start.Code != http.StatusFound {
+		t.Fatalf("login status = %d, want 302", start.Code)
+	}
+	location, err := url.Parse(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims["nonce"] = location.Query().Get("nonce")
+	provider.setClaims(claims)
+
+	return serveTest(engine, http.MethodGet,
+		"/file/login/oidc/callback?code=test&state="+url.QueryEscape(location.Query().Get("state")), start.Result().Cookies())
+}
+
+// 按组映射的用户的组保存在会话中，重启或由共享会话文件的其他实例处理时仍然是该用户而不是游客
+func TestOIDCMappedSessionSurvivesRestart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := newMockOIDCProvider(t)
+	sessionPath := filepath.Join(t.TempDir(), "sessions.json")
+	newInstance := func() *FileManager {
+		fm := newTestOIDCManager(t, provider.server.URL)
+		if err := fm.setSession(SessionConfig{
+			AccessTokenTTL:  Duration(time.Minute),
+			RefreshTokenTTL: Duration(time.Hour),
+			Path:            sessionPath,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return fm
+	}
+
+	first := newInstance()
+	cookies := oidcLogin(t, first.engine(), provider, jwt.MapClaims{
+		"sub":            "bob-sub",
+		"email":          "bob@example.com",
+		"email_verified": true,
+		"groups":         []string{"engineers"},
+	})
+	if recorder := serveTest(first.engine(), http.MethodGet, "/file/settings/sessions", cookies); recorder.Code != http.StatusOK {
+		t.Fatalf("sessions page status = %d, want 200", recorder.Code)
+	}
+
+	// 新实例使用不同的签名密钥，访问 token 失效后用刷新 token 从会话文件中恢复
+	second := newInstance()
+	recorder := serveTest(second.engine(), http.MethodGet, "/file/settings/sessions", cookies)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("sessions page on restarted instance status = %d, want 200", recorder.Code)
+	}
+	sessions := second.sessions.list("bob@example.com")
+	if len(sessions) != 1 || len(sessions[0].OIDCGroups) != 1 {
+		t.Fatalf("sessions = %+v, want one session with groups", sessions)
+	}
+}
+
+// 绑定了 oidc_subject 的本地用户通过 OIDC 登录后使用本地账户
+func TestOIDCLinkedLocalLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := newMockOIDCProvider(t)
+	fm := newTestOIDCManager(t, provider.server.URL)
+	oidcLogin(t, fm.engine(), provider, jwt.MapClaims{"sub": "alice-sub"})
+
+	sessions := fm.sessions.list("alice")
+	if len(sessions) != 1 || len(sessions[0].OIDCGroups) != 0 {
+		t.Fatalf("sessions = %+v, want one local session for alice", sessions)
+	}
+}
+
+// 绑定的本地用户启用了两步验证时，OIDC 登录后仍需输入验证码才会签发会话
+func TestOIDCLoginRequiresTOTP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := newMockOIDCProvider(t)
+	fm := newTestOIDCManager(t, provider.server.URL)
+	engine := fm.engine()
+
+	callback := oidcCallback(t, engine, provider, jwt.MapClaims{"sub": "carol-sub"})
+	if callback.Code != http.StatusSeeOther || callback.Header().Get("Location") != "/file/login/2fa" {
+		t.Fatalf("callback = %d %s, want 303 /file/login/2fa", callback.Code, callback.Header().Get("Location"))
+	}
+	if sessions := fm.sessions.list("carol"); len(sessions) != 0 {
+		t.Fatalf("session issued before second factor: %+v", sessions)
+	}
+
+	key, err := decodeTOTPSecret(testTOTPSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totpCode(key, uint64(time.Now().Unix()/totpPeriod))
+	request := httptest.NewRequest(http.MethodPost, "/file/login/2fa", strings.NewReader(url.Values{"code": {code}}.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range callback.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/file" {
+		t.Fatalf("2fa = %d %s, want 303 /file", recorder.Code, recorder.Header().Get("Location"))
+	}
+	if sessions := fm.sessions.list("carol"); len(sessions) != 1 {
+		t.Fatalf("sessions = %+v, want one after second factor", sessions)
+	}
+}
@@ -0,0 +1,159 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2id 参数，参考 RFC 9106 的推荐配置
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// 密码哈希格式
+const (
+	PasswordSchemeArgon2id = "argon2id"
+	PasswordSchemeBcrypt   = "bcrypt"
+	PasswordSchemeSHA256   = "sha256" // 旧版无盐 SHA-256，登录成功后自动升级
+)
+
+// DefaultHashPassword 使用随机盐的 argon2id 加密密码，输出 $argon2id$v=19$m=65536,t=3,p=4$<盐>$<哈希> 格式
+func DefaultHashPassword(password string) string {
+	salt := make([]byte, argon2SaltLen)
+	_, _ = rand.Read(salt)
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// BcryptHashPassword 使用 bcrypt 加密密码，可以通过 SetHashPassword 替换默认的 argon2id
+func BcryptHashPassword(password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		// 超过 72 字节的密码无法使用 bcrypt，返回无法匹配任何密码的值
+		return ""
+	}
+	return string(hash)
+}
+
+// LegacyHashPassword 旧版无盐 SHA-256，仅用于兼容已有的密码哈希
+func LegacyHashPassword(password string) string {
+	hash := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(hash[:])
+}
+
+// PasswordScheme 识别密码哈希的格式，无法识别时返回空字符串
+func PasswordScheme(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return PasswordSchemeArgon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return PasswordSchemeBcrypt
+	case len(encoded) == sha256.Size*2:
+		if _, err := hex.DecodeString(encoded); err == nil {
+			return PasswordSchemeSHA256
+		}
+	}
+	return ""
+}
+
+// 解析 argon2id 哈希
+func parseArgon2id(encoded string) (memory uint32, iterations uint32, threads uint8, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return 0, 0, 0, nil, nil, fmt.Errorf("argon2id 哈希格式错误")
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return 0, 0, 0, nil, nil, fmt.Errorf("不支持的 argon2 版本 %q", parts[2])
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return 0, 0, 0, nil, nil, fmt.Errorf("argon2id 参数错误: %v", err)
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return 0, 0, 0, nil, nil, fmt.Errorf("argon2id 盐错误: %v", err)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return 0, 0, 0, nil, nil, fmt.Errorf("argon2id 哈希错误: %v", err)
+	}
+	return memory, iterations, threads, salt, key, nil
+}
+
+// 校验密码哈希是否为可识别的格式
+func validatePasswordHash(encoded string) error {
+	switch PasswordScheme(encoded) {
+	case PasswordSchemeArgon2id:
+		_, _, _, _, _, err := parseArgon2id(encoded)
+		return err
+	case PasswordSchemeBcrypt, PasswordSchemeSHA256:
+		return nil
+	}
+	return fmt.Errorf("无法识别的密码哈希格式，支持 argon2id、bcrypt 和 SHA-256")
+}
+
+// 以常量时间比较密码，无法识别的格式交给 legacyHash 计算后比较，兼容 SetHashPassword 设置的自定义算法
+func checkPassword(encoded, password string, legacyHash func(string) string) bool {
+	switch PasswordScheme(encoded) {
+	case PasswordSchemeArgon2id:
+		memory, iterations, threads, salt, key, err := parseArgon2id(encoded)
+		if err != nil {
+			return false
+		}
+		actual := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(actual, key) == 1
+	case PasswordSchemeBcrypt:
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+	case PasswordSchemeSHA256:
+		return subtle.ConstantTimeCompare([]byte(LegacyHashPassword(password)), []byte(strings.ToLower(encoded))) == 1
+	}
+	if encoded == "" || legacyHash == nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(legacyHash(password)), []byte(encoded)) == 1
+}
+
+// 旧版 SHA-256 或参数低于当前配置的 argon2id 哈希需要在登录成功后重新加密
+func needsRehash(encoded string) bool {
+	switch PasswordScheme(encoded) {
+	case PasswordSchemeSHA256:
+		return true
+	case PasswordSchemeArgon2id:
+		memory, iterations, threads, _, key, err := parseArgon2id(encoded)
+		return err != nil || memory < argon2Memory || iterations < argon2Time || threads < argon2Threads || len(key) < argon2KeyLen
+	}
+	return false
+}
+
+// 登录成功后将旧格式的密码哈希升级并写回用户存储
+func (fm *FileManager) rehashPassword(user User, password string) {
+	if !needsRehash(user.EncryptPassword) {
+		return
+	}
+	user.EncryptPassword = fm.hashPassword(password)
+	if PasswordScheme(user.EncryptPassword) == "" || needsRehash(user.EncryptPassword) {
+		return
+	}
+	// 程序设置或配置文件中的用户无法写回，下次登录仍使用旧哈希
+	if err := fm.userStore.Update(user); errors.Is(err, ErrUserReadOnly) {
+		return
+	} else if err != nil {
+		fm.log.Warnf("升级用户 %s 的密码哈希失败: %v", user.Username, err)
+		return
+	}
+	fm.log.Infof("用户 %s 的密码哈希已升级为 %s", user.Username, PasswordScheme(user.EncryptPassword))
+}
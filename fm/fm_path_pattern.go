@@ -0,0 +1,192 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// 路径规则语法(path_restrictions、path_blocking、API token 路径和 acl 的 path)，与 .gitignore 类似：
+//   - 规则按 / 分段，每段支持 * (段内任意字符)、? (单个字符)、[a-z] (字符集合)和 \ 转义，. 等其他字符按字面匹配
+//   - ** 单独成段时匹配任意层目录，例如 /projects/**/build
+//   - 所有规则都从根目录开始匹配，开头的 / 可以省略，public 与 /public 相同；匹配任意层级使用 **/*.log、**/node_modules
+//   - 规则匹配某个目录时同时匹配其下的所有内容，/configs/dev 不匹配 /configs/development
+//   - 以 ! 开头的规则排除之前规则匹配的路径，同一列表中最后一条匹配的规则生效
+//
+// 规则在加载配置和用户文件时校验，解析用户的角色时编译为 pathPatternSet 保存在 effectivePermissions 中，匹配时不再重新编译
+
+// pathPattern 编译后的路径规则
+type pathPattern struct {
+	raw      string
+	negate   bool
+	segments []string
+	literals int // 不含通配符的段数，用于比较 acl 规则的具体程度
+}
+
+// 编译路径规则
+func compilePathPattern(raw string) (*pathPattern, error) {
+	pattern := &pathPattern{raw: raw}
+	text := strings.TrimSpace(raw)
+	if strings.HasPrefix(text, "!") {
+		pattern.negate = true
+		text = text[1:]
+	}
+	if text == "" {
+		return nil, errors.New("规则为空")
+	}
+	if trimmed := strings.Trim(text, "/"); trimmed != "" {
+		pattern.segments = strings.Split(trimmed, "/")
+	}
+	for _, segment := range pattern.segments {
+		if segment == "" {
+			return nil, errors.New("包含空的路径段")
+		}
+		if strings.Contains(segment, "**") && segment != "**" {
+			return nil, fmt.Errorf("** 必须单独成段: %q", segment)
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, fmt.Errorf("%q: %v", segment, err)
+		}
+		if literalSegment(segment) {
+			pattern.literals++
+		}
+	}
+	return pattern, nil
+}
+
+// 路径段不含通配符，\ 转义的字符按字面处理
+func literalSegment(segment string) bool {
+	for i := 0; i < len(segment); i++ {
+		switch segment[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return false
+		}
+	}
+	return true
+}
+
+// 校验路径规则
+func validatePathPattern(pattern string) error {
+	_, err := compilePathPattern(pattern)
+	return err
+}
+
+// 请求路径按 / 分段，根目录为空
+func splitPath(p string) []string {
+	p = strings.Trim(strings.ReplaceAll(p, "\\", "/"), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// 规则段完整匹配路径段
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], segments[0])
+	return ok && matchSegments(pattern[1:], segments[1:])
+}
+
+// 路径段能否作为规则段的前缀，即路径的子路径可能被匹配
+func prefixSegments(pattern, segments []string) bool {
+	if len(segments) == 0 {
+		return true
+	}
+	if len(pattern) == 0 {
+		return false
+	}
+	if pattern[0] == "**" {
+		return true
+	}
+	ok, _ := path.Match(pattern[0], segments[0])
+	return ok && prefixSegments(pattern[1:], segments[1:])
+}
+
+// 路径本身或其上级目录被规则匹配，不考虑 !
+func (p *pathPattern) match(segments []string) bool {
+	for end := 0; end <= len(segments); end++ {
+		if matchSegments(p.segments, segments[:end]) {
+			return true
+		}
+	}
+	return false
+}
+
+// 路径下可能存在被规则匹配的内容，用于显示通往可访问路径的上级目录
+func (p *pathPattern) mayContain(segments []string) bool {
+	return prefixSegments(p.segments, segments)
+}
+
+// pathPatternSet 按顺序判断的规则列表
+type pathPatternSet []*pathPattern
+
+// 编译规则列表，任一规则无法编译时返回错误
+func compilePathPatterns(patterns []string) (pathPatternSet, error) {
+	set := make(pathPatternSet, 0, len(patterns))
+	for _, raw := range patterns {
+		pattern, err := compilePathPattern(raw)
+		if err != nil {
+			return nil, fmt.Errorf("路径规则 %q 无效: %v", raw, err)
+		}
+		set = append(set, pattern)
+	}
+	return set, nil
+}
+
+// 在列表后追加 other 中尚未包含的规则，顺序不变
+func (s pathPatternSet) union(other pathPatternSet) pathPatternSet {
+	for _, pattern := range other {
+		if !slices.ContainsFunc(s, func(p *pathPattern) bool { return p.raw == pattern.raw }) {
+			s = append(s, pattern)
+		}
+	}
+	return s
+}
+
+// 最后一条匹配的规则决定结果，decided 为 false 表示没有规则匹配
+func (s pathPatternSet) decide(segments []string) (matched, decided bool) {
+	for _, pattern := range s {
+		if pattern.match(segments) {
+			matched, decided = !pattern.negate, true
+		}
+	}
+	return matched, decided
+}
+
+// 路径被规则列表匹配
+func (s pathPatternSet) matches(p string) bool {
+	matched, _ := s.decide(splitPath(p))
+	return matched
+}
+
+// 路径被规则列表匹配，或者是可能被匹配的路径的上级目录
+func (s pathPatternSet) reaches(p string) bool {
+	segments := splitPath(p)
+	if matched, decided := s.decide(segments); decided {
+		return matched
+	}
+	for _, pattern := range s {
+		if !pattern.negate && pattern.mayContain(segments) {
+			return true
+		}
+	}
+	return false
+}
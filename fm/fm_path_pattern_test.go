@@ -0,0 +1,138 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustCompilePathPatterns(t *testing.T, patterns ...string) pathPatternSet {
+	t.Helper()
+	set, err := compilePathPatterns(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestPathPatternSetMatches(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		// 所有规则从根目录开始匹配，开头的 / 可以省略
+		{[]string{"/public"}, "/public", true},
+		{[]string{"public"}, "/public/a.txt", true},
+		{[]string{"public"}, "/private/public", false},
+		{[]string{"/projects"}, "/projects2", false},
+		{[]string{"/configs/dev"}, "/configs/development", false},
+		{[]string{"*.log"}, "/app.log", true},
+		{[]string{"*.log"}, "/logs/app.log", false},
+		// ** 匹配任意层目录，包括零层
+		{[]string{"**/*.log"}, "/app.log", true},
+		{[]string{"**/*.log"}, "/logs/2026/app.log", true},
+		{[]string{"**/node_modules"}, "/web/node_modules/x/index.js", true},
+		{[]string{"/data/**/public"}, "/data/public", true},
+		{[]string{"/data/**/public"}, "/data/a/b/public/c", true},
+		{[]string{"/data/**/public"}, "/other/public", false},
+		{[]string{"/projects/*/build"}, "/projects/web/build", true},
+		{[]string{"/projects/*/build"}, "/projects/web/src/build", false},
+		{[]string{"/file?.txt"}, "/file1.txt", true},
+		{[]string{"/[a-c]*"}, "/docs", false},
+		{[]string{`/\*`}, "/*", true},
+		{[]string{`/\*`}, "/a", false},
+		// ! 排除之前匹配的路径，最后一条匹配的规则生效
+		{[]string{"/archive", "!/archive/public"}, "/archive/private", true},
+		{[]string{"/archive", "!/archive/public"}, "/archive/public/a", false},
+		{[]string{"/archive", "!/archive/public", "/archive/public/keep"}, "/archive/public/keep", true},
+		{[]string{"!/archive"}, "/archive", false},
+		{nil, "/", false},
+	}
+	for _, tt := range tests {
+		set := mustCompilePathPatterns(t, tt.patterns...)
+		if got := set.matches(tt.path); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
+
+// 可访问路径的上级目录同样可以访问，被 ! 排除的路径不能通过上级目录放行
+func TestPathPatternSetReaches(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{[]string{"/data/projects"}, "/", true},
+		{[]string{"/data/projects"}, "/data", true},
+		{[]string{"/data/projects"}, "/data/projects/a", true},
+		{[]string{"/data/projects"}, "/data/other", false},
+		{[]string{"/data/*/public"}, "/data/web", true},
+		{[]string{"/data/*/public"}, "/data/web/private", false},
+		{[]string{"**/public"}, "/any/where", true},
+		{[]string{"public"}, "/private", false},
+		{[]string{"/data/projects", "!/data"}, "/data", false},
+		{[]string{"/data", "!/data/secret"}, "/data/secret/a", false},
+		{[]string{"/"}, "/anything", true},
+		{nil, "/", false},
+	}
+	for _, tt := range tests {
+		set := mustCompilePathPatterns(t, tt.patterns...)
+		if got := set.reaches(tt.path); got != tt.want {
+			t.Errorf("%q reaches %s = %v, want %v", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCompilePathPatternInvalid(t *testing.T) {
+	for _, pattern := range []string{"", "!", "/a//b", "/a**", "/[a-"} {
+		if _, err := compilePathPattern(pattern); err == nil {
+			t.Errorf("compilePathPattern(%q) succeeded, want error", pattern)
+		}
+	}
+}
+
+// 路径规则无法编译时用户按无权限处理，管理员不受影响
+func TestInvalidPathPatternFailsClosed(t *testing.T) {
+	roles := newRoleRegistry()
+	user := roles.resolve(User{
+		Username:                 "alice",
+		Permissions:              map[string]bool{PermissionFileView: true},
+		BaseRolePathRestrictions: []string{"/public"},
+		BaseRolePathBlocking:     []string{"/[a-"},
+	})
+	if user.IsPathAllowed("/public") || user.Can(PermissionFileView, "/public") {
+		t.Error("user with an invalid blocking rule can access /public")
+	}
+
+	user = roles.resolve(User{Username: "bob", ACL: []ACLRule{{Path: "/[a-", Deny: []string{PermissionFileView}}}, BaseRolePathRestrictions: []string{"/"}})
+	if user.Can(PermissionFileView, "/a") {
+		t.Error("user with an invalid acl rule can view /a")
+	}
+
+	admin := roles.resolve(User{Username: "admin", Roles: []string{RoleAdmin}, BaseRolePathBlocking: []string{"/[a-"}})
+	if !admin.IsPathAllowed("/public") || !admin.Can(PermissionFileView, "/public") {
+		t.Error("admin is restricted by an invalid rule")
+	}
+
+	token := APIToken{Permissions: []string{PermissionFileView}, PathRestrictions: []string{"/[a-"}}
+	scoped := token.scope(roles.resolve(User{Username: "carol", Permissions: map[string]bool{PermissionFileView: true}, BaseRolePathRestrictions: []string{"/"}}))
+	if scoped.IsPathAllowed("/a") {
+		t.Error("token with an invalid path rule can access /a")
+	}
+}
+
+// 用户文件中的无效规则在加载时被拒绝
+func TestLoadUsersFileRejectsInvalidPattern(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	data := "users:\n  alice:\n    path_restrictions: [\"/a**\"]\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadUsersFile(path); err == nil || !strings.Contains(err.Error(), "path_restrictions") {
+		t.Fatalf("LoadUsersFile err = %v, want path_restrictions error", err)
+	}
+}
@@ -0,0 +1,379 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// RoleAdmin 内置的管理员角色，拥有所有权限且不受路径限制，不能在 roles 中重新定义
+const RoleAdmin = "admin"
+
+// RoleConfig 命名角色，定义一次后由用户、组和外部身份源的组映射引用
+type RoleConfig struct {
+	Permissions      []string  `json:"permissions,omitempty"       yaml:"permissions,omitempty"       toml:"permissions,omitempty"`
+	PathRestrictions []string  `json:"path_restrictions,omitempty" yaml:"path_restrictions,omitempty" toml:"path_restrictions,omitempty"`
+	PathBlocking     []string  `json:"path_blocking,omitempty"     yaml:"path_blocking,omitempty"     toml:"path_blocking,omitempty"`
+	ACL              []ACLRule `json:"acl,omitempty"               yaml:"acl,omitempty"               toml:"acl,omitempty"` // 按路径授予或拒绝的权限
+}
+
+// GroupConfig 用户组，组成员拥有组内所有角色
+type GroupConfig struct {
+	Roles []string `json:"roles" yaml:"roles" toml:"roles"`
+}
+
+// 校验角色和组定义，组引用的角色必须已定义
+func validateRoles(roles map[string]RoleConfig, groups map[string]GroupConfig) []error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(roles)) {
+		field := "roles." + name
+		switch {
+		case strings.TrimSpace(name) == "":
+			errs = append(errs, errors.New("roles: 角色名不能为空"))
+		case name == RoleAdmin:
+			errs = append(errs, fmt.Errorf("%s: %s 为内置角色，不能重新定义", field, RoleAdmin))
+		}
+		role := roles[name]
+		uc := UserConfig{Permissions: role.Permissions, PathRestrictions: role.PathRestrictions, PathBlocking: role.PathBlocking, ACL: role.ACL}
+		errs = append(errs, uc.validate(field)...)
+	}
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		if strings.TrimSpace(name) == "" {
+			errs = append(errs, errors.New("groups: 组名不能为空"))
+		}
+		errs = append(errs, validateRoleNames("groups."+name+".roles", groups[name].Roles, roles)...)
+	}
+	return errs
+}
+
+// 校验引用的角色名
+func validateRoleNames(field string, names []string, roles map[string]RoleConfig) []error {
+	var errs []error
+	for _, name := range names {
+		if _, ok := roles[name]; !ok && name != RoleAdmin {
+			errs = append(errs, fmt.Errorf("%s: 未定义的角色 %q", field, name))
+		}
+	}
+	return errs
+}
+
+// 校验组映射引用的角色
+func validateGroupMappingRoles(field string, mappings []GroupMapping, roles map[string]RoleConfig) []error {
+	var errs []error
+	for i, mapping := range mappings {
+		if mapping.Role != "" {
+			errs = append(errs, validateRoleNames(fmt.Sprintf("%s[%d].role", field, i), []string{mapping.Role}, roles)...)
+		}
+	}
+	return errs
+}
+
+// 校验用户引用的角色和组
+func validateUserRoles(field string, uc UserConfig, roles map[string]RoleConfig, groups map[string]GroupConfig) []error {
+	errs := validateRoleNames(field+".roles", uc.Roles, roles)
+	for _, name := range uc.Groups {
+		if _, ok := groups[name]; !ok {
+			errs = append(errs, fmt.Errorf("%s.groups: 未定义的组 %q", field, name))
+		}
+	}
+	return errs
+}
+
+// effectivePermissions 用户自身、角色和所在组的角色合并后的权限，权限和可访问路径取并集，任一角色屏蔽的路径都不可访问
+type effectivePermissions struct {
+	roles             []string
+	admin             bool
+	permissions       map[string]bool
+	restrictions      pathPatternSet
+	blocking          pathPatternSet
+	tokenRestrictions pathPatternSet  // API token 限定的路径，非空时路径还需匹配
+	acl               []aclRule       // 所有来源的路径规则，按 ACLRule 的优先级判断
+	defaults          []aclRule       // 挂载点拒绝的权限，acl 没有涉及时收窄全局权限
+	limit             map[string]bool // API token 限定的权限，为空时不限制
+	err               error           // 路径规则无法编译，此时除管理员外按无权限处理
+	home              string          // 家目录，相对根目录，为空时不限制，见 absPath
+}
+
+// 请求中相对家目录的路径转换为相对根目录的路径，路径规则、acl 和挂载点的默认权限都按根目录匹配
+func (e *effectivePermissions) absPath(p string) string {
+	if e.home == "" {
+		return p
+	}
+	return path.Join(e.home, p)
+}
+
+// 编译合并后的路径规则，错误记录在 err 中
+func (e *effectivePermissions) compile(restrictions, blocking, tokenRestrictions []string, acl []ACLRule) {
+	var errs [4]error
+	e.restrictions, errs[0] = compilePathPatterns(restrictions)
+	e.blocking, errs[1] = compilePathPatterns(blocking)
+	e.tokenRestrictions, errs[2] = compilePathPatterns(tokenRestrictions)
+	e.acl, errs[3] = compileACL(acl)
+	e.err = errors.Join(errs[:]...)
+}
+
+// 全局权限，不考虑路径规则
+func (e *effectivePermissions) has(permission string) bool {
+	if e.limit != nil && !e.limit[permission] {
+		return false
+	}
+	return e.admin || e.permissions[permission]
+}
+
+// 用户直接拥有的角色，role 为兼容旧配置的单个角色
+func (u *User) roleNames() []string {
+	if u.Role == "" {
+		return u.Roles
+	}
+	return appendUnique([]string{u.Role}, u.Roles...)
+}
+
+// 合并后的权限，未经 roleRegistry 解析的用户只使用自身的权限和内置的 admin 角色，每次调用都重新编译路径规则
+func (u *User) effective() *effectivePermissions {
+	if u.resolved != nil {
+		return u.resolved
+	}
+	roles := u.roleNames()
+	effective := &effectivePermissions{
+		roles:       roles,
+		admin:       slices.Contains(roles, RoleAdmin),
+		permissions: u.Permissions,
+	}
+	effective.compile(u.BaseRolePathRestrictions, u.BaseRolePathBlocking, u.TokenPathRestrictions, u.ACL)
+	return effective
+}
+
+// EffectiveRoles 用户直接拥有和通过组获得的角色
+func (u *User) EffectiveRoles() []string {
+	return u.effective().roles
+}
+
+// roleRegistry 角色和组定义，角色的路径规则在设置时编译，解析后的用户权限按用户名缓存
+type roleRegistry struct {
+	mu         sync.RWMutex
+	roles      map[string]compiledRole
+	groups     map[string]GroupConfig
+	defaults   []aclRule // 挂载点的默认权限，所有用户共用
+	generation uint64    // 角色、挂载点默认权限或家目录设置变化时递增，之前缓存的解析结果失效
+
+	cacheMu sync.Mutex
+	cache   map[string]resolvedEntry // 键为用户名
+}
+
+// compiledRole 编译了路径规则的角色
+type compiledRole struct {
+	permissions  []string
+	restrictions pathPatternSet
+	blocking     pathPatternSet
+	acl          []aclRule
+}
+
+// 编译角色的路径规则
+func compileRole(role RoleConfig) (compiledRole, error) {
+	compiled := compiledRole{permissions: role.Permissions}
+	var errs [3]error
+	compiled.restrictions, errs[0] = compilePathPatterns(role.PathRestrictions)
+	compiled.blocking, errs[1] = compilePathPatterns(role.PathBlocking)
+	compiled.acl, errs[2] = compileACL(role.ACL)
+	return compiled, errors.Join(errs[:]...)
+}
+
+// resolvedEntry 缓存的解析结果，只在生成时的配置版本和用户字段都未变化时使用
+type resolvedEntry struct {
+	generation uint64
+	source     User
+	resolved   *effectivePermissions
+}
+
+func newRoleRegistry() *roleRegistry {
+	return &roleRegistry{roles: map[string]compiledRole{}, groups: map[string]GroupConfig{}}
+}
+
+func (rr *roleRegistry) set(roles map[string]RoleConfig, groups map[string]GroupConfig) error {
+	compiled := make(map[string]compiledRole, len(roles))
+	for name, role := range roles {
+		var err error
+		if compiled[name], err = compileRole(role); err != nil {
+			return fmt.Errorf("roles.%s: %w", name, err)
+		}
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.roles, rr.groups = compiled, maps.Clone(groups)
+	rr.generation++
+	return nil
+}
+
+func (rr *roleRegistry) setDefaults(defaults []ACLRule) error {
+	compiled, err := compileACL(defaults)
+	if err != nil {
+		return err
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.defaults = compiled
+	rr.generation++
+	return nil
+}
+
+// 使缓存的解析结果失效，用于家目录等影响解析结果的设置变化
+func (rr *roleRegistry) invalidate() {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.generation++
+}
+
+// 解析用户的角色和组，HasPermission、IsPathAllowed 使用解析后的权限，未定义的角色和组被忽略。
+// 角色的路径规则已在设置时编译，这里只编译用户自身的规则
+func (rr *roleRegistry) resolve(user User) User {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+	user.resolved = rr.resolveLocked(user)
+	return user
+}
+
+// 解析用户，调用方需持有读锁
+func (rr *roleRegistry) resolveLocked(user User) *effectivePermissions {
+	names := slices.Clone(user.roleNames())
+	for _, group := range user.Groups {
+		names = appendUnique(names, rr.groups[group].Roles...)
+	}
+	resolved := &effectivePermissions{
+		roles:       names,
+		permissions: maps.Clone(user.Permissions),
+		defaults:    rr.defaults,
+	}
+	resolved.compile(user.BaseRolePathRestrictions, user.BaseRolePathBlocking, user.TokenPathRestrictions, user.ACL)
+	if resolved.permissions == nil {
+		resolved.permissions = map[string]bool{}
+	}
+	for _, name := range names {
+		if name == RoleAdmin {
+			resolved.admin = true
+			continue
+		}
+		role, ok := rr.roles[name]
+		if !ok {
+			continue
+		}
+		for _, permission := range role.permissions {
+			resolved.permissions[permission] = true
+		}
+		resolved.restrictions = resolved.restrictions.union(role.restrictions)
+		resolved.blocking = resolved.blocking.union(role.blocking)
+		resolved.acl = append(resolved.acl, role.acl...)
+	}
+	return resolved
+}
+
+// 解析用户并按用户名缓存结果，home 返回用户的家目录。配置版本和用户的字段都未变化时直接使用缓存，
+// fresh 为 true 表示本次重新解析
+func (rr *roleRegistry) resolveCached(user User, home func(User) string) (resolvedUser User, fresh bool) {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	rr.cacheMu.Lock()
+	entry, ok := rr.cache[user.Username]
+	rr.cacheMu.Unlock()
+	if ok && entry.generation == rr.generation && samePermissionSource(entry.source, user) {
+		user.resolved = entry.resolved
+		return user, false
+	}
+
+	resolved := rr.resolveLocked(user)
+	user.resolved = resolved
+	resolved.home = home(user)
+
+	rr.cacheMu.Lock()
+	defer rr.cacheMu.Unlock()
+	if rr.cache == nil || entry.generation != rr.generation {
+		// 配置变化后丢弃所有旧的结果，避免已删除的用户一直留在缓存中
+		rr.cache = map[string]resolvedEntry{}
+	}
+	rr.cache[user.Username] = resolvedEntry{generation: rr.generation, source: user, resolved: resolved}
+	return user, true
+}
+
+// 两个用户影响权限解析的字段相同
+func samePermissionSource(a, b User) bool {
+	return a.Role == b.Role && a.Home == b.Home &&
+		slices.Equal(a.Roles, b.Roles) &&
+		slices.Equal(a.Groups, b.Groups) &&
+		maps.Equal(a.Permissions, b.Permissions) &&
+		slices.Equal(a.BaseRolePathRestrictions, b.BaseRolePathRestrictions) &&
+		slices.Equal(a.BaseRolePathBlocking, b.BaseRolePathBlocking) &&
+		slices.Equal(a.TokenPathRestrictions, b.TokenPathRestrictions) &&
+		slices.EqualFunc(a.ACL, b.ACL, ACLRule.equal)
+}
+
+// SetRoles 设置命名角色和用户组，已登录的会话在下一次请求时使用新的定义
+func (fm *FileManager) SetRoles(roles map[string]RoleConfig, groups map[string]GroupConfig) *FileManager {
+	if err := fm.setRoles(roles, groups); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setRoles(roles map[string]RoleConfig, groups map[string]GroupConfig) error {
+	if err := errors.Join(validateRoles(roles, groups)...); err != nil {
+		return err
+	}
+	return fm.roles.set(roles, groups)
+}
+
+// 解析用户的角色和组，结果在配置和用户不变时复用。配置和用户文件加载时已拒绝无效的路径规则，
+// 其他来源的用户规则无法编译时只在解析时记录一次错误，该用户除管理员外按无权限处理
+func (fm *FileManager) resolveUser(user User) User {
+	user, fresh := fm.roles.resolveCached(user, func(user User) string {
+		// 家目录无效时 filesFor 同样失败，请求会被拒绝
+		home, _ := fm.homeFor(user)
+		return home
+	})
+	if err := user.resolved.err; fresh && err != nil {
+		fm.log.Errorf("用户 %s 的路径规则无效: %v", user.Username, err)
+	}
+	return user
+}
+
+// 校验通过 SetUsers、SetGuestUser 设置的用户的路径规则
+func validateUserRules(field string, user User) []error {
+	var errs []error
+	for _, rules := range []struct {
+		name     string
+		patterns []string
+	}{
+		{"path_restrictions", user.BaseRolePathRestrictions},
+		{"path_blocking", user.BaseRolePathBlocking},
+		{"token_path_restrictions", user.TokenPathRestrictions},
+	} {
+		for _, pattern := range rules.patterns {
+			if err := validatePathPattern(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("%s.%s: %q 无法编译: %v", field, rules.name, pattern, err))
+			}
+		}
+	}
+	return append(errs, validateACL(field+".acl", user.ACL)...)
+}
+
+// 解析所有用户，在启动和重新加载用户后提前编译路径规则并记录无效的规则
+func (fm *FileManager) resolveAllUsers() {
+	users, err := fm.userStore.List()
+	if err != nil {
+		fm.log.Errorf("读取用户列表失败: %v", err)
+		return
+	}
+	for _, user := range users {
+		fm.resolveUser(user)
+	}
+	fm.guest()
+}
+
+// 游客，角色和组已解析
+func (fm *FileManager) guest() User {
+	return fm.resolveUser(fm.users.guest())
+}
@@ -0,0 +1,123 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// 用户自身、角色和组的权限与可访问路径取并集，任一角色屏蔽的路径和 acl 拒绝对所有来源生效
+func TestRoleGroupMerge(t *testing.T) {
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetRoles(map[string]RoleConfig{
+		"editor": {
+			Permissions:      []string{PermissionDirView, PermissionFileView, PermissionFileEdit},
+			PathRestrictions: []string{"/projects"},
+			ACL:              []ACLRule{{Path: "/projects/frozen", Deny: []string{PermissionFileEdit}}},
+		},
+		"auditor":  {Permissions: []string{PermissionDirView, PermissionFileView}, PathRestrictions: []string{"/logs"}, PathBlocking: []string{"/projects/secret"}},
+		"uploader": {Permissions: []string{PermissionDirUpload}},
+	}, map[string]GroupConfig{
+		"dev":    {Roles: []string{"editor", "uploader"}},
+		"ops":    {Roles: []string{"auditor"}},
+		"admins": {Roles: []string{RoleAdmin}},
+	})
+	users := map[string]User{
+		"carol": fm.resolveUser(User{Username: "carol", Role: "editor", Groups: []string{"ops"}}),
+		"dave":  fm.resolveUser(User{Username: "dave", Groups: []string{"dev"}, Permissions: map[string]bool{PermissionFileDownload: true}, BaseRolePathRestrictions: []string{"/shared"}}),
+		"erin":  fm.resolveUser(User{Username: "erin", Groups: []string{"admins"}}),
+		"frank": fm.resolveUser(User{Username: "frank", Roles: []string{"missing"}, Groups: []string{"missing"}}),
+	}
+
+	roles := map[string][]string{
+		"carol": {"editor", "auditor"},
+		"dave":  {"editor", "uploader"},
+		"erin":  {RoleAdmin},
+		"frank": {"missing"},
+	}
+	for username, want := range roles {
+		user := users[username]
+		if got := user.EffectiveRoles(); !slices.Equal(got, want) {
+			t.Errorf("%s roles = %v, want %v", username, got, want)
+		}
+	}
+
+	tests := []struct {
+		username   string
+		permission string
+		path       string
+		want       bool
+	}{
+		{"carol", PermissionFileEdit, "/projects/a.go", true},
+		{"carol", PermissionFileView, "/logs/app.log", true},
+		{"carol", PermissionFileEdit, "/logs/app.log", true},
+		{"carol", PermissionFileView, "/projects/secret/key", false},
+		{"carol", PermissionFileEdit, "/projects/frozen/a.go", false},
+		{"carol", PermissionDirUpload, "/projects", false},
+		{"dave", PermissionDirUpload, "/projects", true},
+		{"dave", PermissionFileDownload, "/shared/a.zip", true},
+		{"dave", PermissionFileView, "/logs/app.log", false},
+		{"dave", PermissionFileView, "/projects/secret/key", true},
+		{"erin", PermissionFileDelete, "/anything", true},
+		{"frank", PermissionFileView, "/projects/a.go", false},
+	}
+	for _, tt := range tests {
+		user := users[tt.username]
+		if got := user.Can(tt.permission, tt.path) && user.IsPathAllowed(tt.path); got != tt.want {
+			t.Errorf("%s: %s on %s = %v, want %v", tt.username, tt.permission, tt.path, got, tt.want)
+		}
+	}
+}
+
+// 配置和用户都未变化时复用解析结果，角色、家目录或用户字段变化后重新解析
+func TestResolveUserCache(t *testing.T) {
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetRoles(map[string]RoleConfig{
+		"viewer": {Permissions: []string{PermissionFileView}, PathRestrictions: []string{"/public"}},
+	}, nil)
+	alice := User{Username: "alice", Roles: []string{"viewer"}}
+
+	first := fm.resolveUser(alice)
+	if second := fm.resolveUser(alice); second.resolved != first.resolved {
+		t.Error("unchanged user is resolved again")
+	}
+
+	changed := alice
+	changed.BaseRolePathBlocking = []string{"/public/secret"}
+	if resolved := fm.resolveUser(changed); resolved.resolved == first.resolved || resolved.IsPathAllowed("/public/secret") {
+		t.Error("changed user fields reuse the cached permissions")
+	}
+
+	fm.SetRoles(map[string]RoleConfig{
+		"viewer": {Permissions: []string{PermissionFileView}, PathRestrictions: []string{"/docs"}},
+	}, nil)
+	resolved := fm.resolveUser(alice)
+	if resolved.resolved == first.resolved || resolved.IsPathAllowed("/public") || !resolved.IsPathAllowed("/docs") {
+		t.Error("SetRoles does not invalidate the cached permissions")
+	}
+
+	fm.SetHomeDir("home/{username}")
+	if home := fm.resolveUser(alice).resolved.home; home != "home/alice" {
+		t.Errorf("home after SetHomeDir = %q, want home/alice", home)
+	}
+}
+
+// 角色和用户的无效路径规则在设置时被拒绝，保留之前的设置
+func TestSetRulesRejectsInvalidPattern(t *testing.T) {
+	fm := NewFileManager(t.TempDir(), zap.NewNop())
+	if err := fm.setRoles(map[string]RoleConfig{"broken": {PathBlocking: []string{"/[a-"}}}, nil); err == nil {
+		t.Error("setRoles accepted an invalid path_blocking rule")
+	}
+
+	valid := map[string]User{"alice": {Username: "alice"}}
+	if err := fm.setUsers(valid); err != nil {
+		t.Fatal(err)
+	}
+	invalid := map[string]User{"bob": {Username: "bob", ACL: []ACLRule{{Path: "/a**", Deny: []string{PermissionFileView}}}}}
+	if err := fm.setUsers(invalid); err == nil {
+		t.Error("setUsers accepted an invalid acl rule")
+	}
+	if _, ok := fm.lookupUser("alice"); !ok {
+		t.Error("invalid users replaced the previous users")
+	}
+}
@@ -0,0 +1,529 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 符号链接策略
+const (
+	SymlinkFollow = "follow" // 跟随指向根目录内的符号链接，指向根目录外时拒绝，权限按链接目标的路径判断
+	SymlinkDeny   = "deny"   // 拒绝访问经过符号链接的路径
+	SymlinkAllow  = "allow"  // 跟随所有符号链接，包括指向根目录外的，权限按链接本身的路径判断
+)
+
+var (
+	ErrPathEscape    = errors.New("路径超出根目录")
+	ErrSymlinkDenied = errors.New("路径中包含符号链接")
+	ErrInvalidPath   = errors.New("路径包含非法字符")
+	ErrReadOnly      = errors.New("只读，不能修改")
+)
+
+// 会修改文件的打开方式
+const writeFlags = os.O_WRONLY | os.O_RDWR | os.O_CREATE | os.O_TRUNC | os.O_APPEND
+
+// 校验符号链接策略
+func validateSymlinkPolicy(policy string) error {
+	switch policy {
+	case SymlinkFollow, SymlinkDeny, SymlinkAllow:
+		return nil
+	default:
+		return fmt.Errorf("%q 应为 %s、%s 或 %s", policy, SymlinkFollow, SymlinkDeny, SymlinkAllow)
+	}
+}
+
+// rootFS 根目录，请求中的路径先经过 resolve 转换为规范路径，权限检查和文件操作都使用规范路径，
+// follow、deny 策略下文件通过 os.Root 打开，即使解析后路径被替换为符号链接也无法访问根目录外的文件
+type rootFS struct {
+	dir       string
+	policy    string
+	readOnly  *atomic.Bool       // 只读，家目录视图与所在的根目录共用，运行时可以切换
+	maxUpload int64              // 上传大小限制，0 表示使用全局设置
+	mounts    map[string]*rootFS // 挂载点，非空时为挂载点列表，见 mountOf
+
+	mu      sync.Mutex
+	root    *os.Root
+	realDir string
+	subs    map[string]*rootFS // 家目录视图，见 sub
+}
+
+func newRootFS(dir string) *rootFS {
+	return &rootFS{dir: dir, policy: SymlinkFollow, readOnly: new(atomic.Bool)}
+}
+
+// 打开根目录，失败时下次调用重试
+func (r *rootFS) handle() (*os.Root, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.root != nil {
+		return r.root, r.realDir, nil
+	}
+	realDir, err := filepath.EvalSymlinks(r.dir)
+	if err != nil {
+		return nil, "", err
+	}
+	root, err := os.OpenRoot(realDir)
+	if err != nil {
+		return nil, "", err
+	}
+	r.root, r.realDir = root, realDir
+	return root, realDir, nil
+}
+
+// 清理路径，去掉 . 和多余的 /，.. 超出根目录时报错
+func cleanSegments(p string) ([]string, error) {
+	if strings.ContainsRune(p, 0) {
+		return nil, ErrInvalidPath
+	}
+	var segments []string
+	for _, segment := range strings.Split(strings.ReplaceAll(p, "\\", "/"), "/") {
+		switch segment {
+		case "", ".":
+		case "..":
+			if len(segments) == 0 {
+				return nil, ErrPathEscape
+			}
+			segments = segments[:len(segments)-1]
+		default:
+			segments = append(segments, segment)
+		}
+	}
+	return segments, nil
+}
+
+// 解析请求中的路径，返回相对根目录、以 / 分隔的规范路径，根目录为空字符串；
+// follow 策略下路径中的符号链接被替换为目标路径，不存在的部分保持原样
+func (r *rootFS) resolve(p string) (string, error) {
+	segments, err := cleanSegments(p)
+	if err != nil {
+		return "", err
+	}
+	if r.mounts != nil {
+		return r.resolveMount(segments)
+	}
+	if r.policy == SymlinkAllow {
+		return strings.Join(segments, "/"), nil
+	}
+	_, realDir, err := r.handle()
+	if err != nil {
+		return "", err
+	}
+
+	for i := range segments {
+		full := filepath.Join(realDir, filepath.FromSlash(strings.Join(segments[:i+1], "/")))
+		info, statErr := os.Lstat(full)
+		if errors.Is(statErr, fs.ErrNotExist) {
+			break
+		}
+		if statErr != nil {
+			return "", statErr
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if r.policy == SymlinkDeny {
+			return "", ErrSymlinkDenied
+		}
+		target, evalErr := filepath.EvalSymlinks(full)
+		if evalErr != nil {
+			return "", ErrPathEscape
+		}
+		rel, relErr := filepath.Rel(realDir, target)
+		if relErr != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", ErrPathEscape
+		}
+		// 目标路径中不再包含符号链接，继续解析剩余部分
+		return r.resolve(path.Join(append([]string{filepath.ToSlash(rel)}, segments[i+1:]...)...))
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// 解析删除、重命名等作用于路径本身的操作的路径：只解析所在目录，最后一级保持原样，
+// 最后一级是符号链接时操作链接本身而不是链接目标
+func (r *rootFS) resolveEntry(p string) (string, error) {
+	segments, err := cleanSegments(p)
+	if err != nil {
+		return "", err
+	}
+	if len(segments) == 0 {
+		return "", nil
+	}
+	parent, err := r.resolve(strings.Join(segments[:len(segments)-1], "/"))
+	if err != nil {
+		return "", err
+	}
+	entry := path.Join(parent, segments[len(segments)-1])
+	if r.policy == SymlinkDeny {
+		if info, statErr := r.Lstat(entry); statErr == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return "", ErrSymlinkDenied
+		}
+	}
+	return entry, nil
+}
+
+// 规范路径对应的本地路径
+func (r *rootFS) localPath(rel string) string {
+	if r.mounts != nil {
+		m, sub, err := r.mountOf(rel)
+		if err != nil {
+			return ""
+		}
+		return m.localPath(sub)
+	}
+	return filepath.Join(r.dir, filepath.FromSlash(rel))
+}
+
+// os.Root 使用的相对路径，根目录为 .
+func rootName(rel string) string {
+	if rel == "" {
+		return "."
+	}
+	return filepath.FromSlash(rel)
+}
+
+func (r *rootFS) Stat(rel string) (fs.FileInfo, error) {
+	if r.mounts != nil {
+		if rel == "" {
+			return mountTableInfo{}, nil
+		}
+		m, sub, err := r.mountOf(rel)
+		if err != nil {
+			return nil, err
+		}
+		return m.Stat(sub)
+	}
+	if r.policy == SymlinkAllow {
+		return os.Stat(r.localPath(rel))
+	}
+	root, _, err := r.handle()
+	if err != nil {
+		return nil, err
+	}
+	return root.Stat(rootName(rel))
+}
+
+// Lstat 不跟随最后一级的符号链接
+func (r *rootFS) Lstat(rel string) (fs.FileInfo, error) {
+	if r.mounts != nil {
+		if rel == "" {
+			return mountTableInfo{}, nil
+		}
+		m, sub, err := r.mountOf(rel)
+		if err != nil {
+			return nil, err
+		}
+		return m.Lstat(sub)
+	}
+	if r.policy == SymlinkAllow {
+		return os.Lstat(r.localPath(rel))
+	}
+	root, _, err := r.handle()
+	if err != nil {
+		return nil, err
+	}
+	return root.Lstat(rootName(rel))
+}
+
+func (r *rootFS) OpenFile(rel string, flag int, perm fs.FileMode) (*os.File, error) {
+	if r.mounts != nil {
+		m, sub, err := r.mountOf(rel)
+		if err != nil {
+			return nil, err
+		}
+		return m.OpenFile(sub, flag, perm)
+	}
+	if r.readOnly.Load() && flag&writeFlags != 0 {
+		return nil, ErrReadOnly
+	}
+	if r.policy == SymlinkAllow {
+		return os.OpenFile(r.localPath(rel), flag, perm)
+	}
+	root, _, err := r.handle()
+	if err != nil {
+		return nil, err
+	}
+	return root.OpenFile(rootName(rel), flag, perm)
+}
+
+func (r *rootFS) Open(rel string) (*os.File, error) {
+	return r.OpenFile(rel, os.O_RDONLY, 0)
+}
+
+func (r *rootFS) Create(rel string) (*os.File, error) {
+	return r.OpenFile(rel, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+func (r *rootFS) ReadFile(rel string) ([]byte, error) {
+	file, err := r.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func (r *rootFS) WriteFile(rel string, data []byte, perm fs.FileMode) error {
+	file, err := r.OpenFile(rel, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadDir 按名称排序的目录内容
+func (r *rootFS) ReadDir(rel string) ([]fs.DirEntry, error) {
+	if r.mounts != nil && rel == "" {
+		return r.mountEntries(), nil
+	}
+	dir, err := r.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	entries, err := dir.ReadDir(-1)
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, err
+}
+
+// MkdirAll 逐级创建目录
+func (r *rootFS) MkdirAll(rel string, perm fs.FileMode) error {
+	if r.mounts != nil {
+		m, sub, err := r.mountOf(rel)
+		if err != nil {
+			return err
+		}
+		return m.MkdirAll(sub, perm)
+	}
+	if r.readOnly.Load() {
+		return ErrReadOnly
+	}
+	if r.policy == SymlinkAllow {
+		return os.MkdirAll(r.localPath(rel), perm)
+	}
+	root, _, err := r.handle()
+	if err != nil {
+		return err
+	}
+	segments := strings.Split(rel, "/")
+	for i := range segments {
+		err = root.Mkdir(rootName(strings.Join(segments[:i+1], "/")), perm)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveAll 删除文件或目录，路径本身是符号链接时只删除链接，路径需要先经过 resolveEntry
+func (r *rootFS) RemoveAll(rel string) error {
+	if r.mounts != nil {
+		m, sub, err := r.mountOf(rel)
+		if err != nil {
+			return err
+		}
+		return m.RemoveAll(sub)
+	}
+	if rel == "" {
+		return ErrPathEscape
+	}
+	if r.readOnly.Load() {
+		return ErrReadOnly
+	}
+	if r.policy == SymlinkAllow {
+		return os.RemoveAll(r.localPath(rel))
+	}
+	root, _, err := r.handle()
+	if err != nil {
+		return err
+	}
+	return removeAllInRoot(root, rootName(rel))
+}
+
+// 通过 os.Root 逐级删除，只进入不是符号链接的目录，删除过程中路径被替换为符号链接也不会删除根目录外的文件
+func removeAllInRoot(root *os.Root, name string) error {
+	info, err := root.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		dir, err := root.Open(name)
+		if err != nil {
+			return err
+		}
+		entries, err := dir.ReadDir(-1)
+		dir.Close()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err = removeAllInRoot(root, filepath.Join(name, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	err = root.Remove(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Rename 重命名，两个路径都需要先经过 resolveEntry
+func (r *rootFS) Rename(oldRel, newRel string) error {
+	if r.mounts != nil {
+		oldMount, oldSub, err := r.mountOf(oldRel)
+		if err != nil {
+			return err
+		}
+		newMount, newSub, err := r.mountOf(newRel)
+		if err != nil {
+			return err
+		}
+		if oldMount != newMount {
+			return ErrCrossMount
+		}
+		return oldMount.Rename(oldSub, newSub)
+	}
+	if oldRel == "" || newRel == "" {
+		return ErrPathEscape
+	}
+	if r.readOnly.Load() {
+		return ErrReadOnly
+	}
+	if r.policy == SymlinkAllow {
+		return os.Rename(r.localPath(oldRel), r.localPath(newRel))
+	}
+	root, _, err := r.handle()
+	if err != nil {
+		return err
+	}
+	return renameInRoot(root, rootName(oldRel), rootName(newRel))
+}
+
+// 路径是否只读，挂载点列表本身只读
+func (r *rootFS) isReadOnly(rel string) bool {
+	if r.mounts != nil {
+		m, sub, err := r.mountOf(rel)
+		return err != nil || m.isReadOnly(sub)
+	}
+	return r.readOnly.Load()
+}
+
+// 路径所在位置的上传大小限制
+func (r *rootFS) uploadLimit(rel string, fallback int64) int64 {
+	if r.mounts != nil {
+		if m, sub, err := r.mountOf(rel); err == nil {
+			return m.uploadLimit(sub, fallback)
+		}
+	}
+	if r.maxUpload > 0 {
+		return r.maxUpload
+	}
+	return fallback
+}
+
+// 所有位置中最大的上传大小限制
+func (r *rootFS) maxUploadLimit(fallback int64) int64 {
+	limit := r.uploadLimit("", fallback)
+	for _, m := range r.mounts {
+		limit = max(limit, m.uploadLimit("", fallback))
+	}
+	return limit
+}
+
+// 解析请求中的 path 参数(查询参数优先)，与用户可见的根目录一起保存到上下文，无法解析时返回 403 并中止请求
+func (fm *FileManager) resolveRequestPath(c *gin.Context, user User) bool {
+	if _, ok := c.Get("path"); ok {
+		return true
+	}
+	files, err := fm.filesFor(user)
+	if err != nil {
+		fm.log.Errorf("打开用户 %s 的家目录失败: %v", user.Username, err)
+		fm.respondError(c, http.StatusInternalServerError, "error.home_unavailable")
+		c.Abort()
+		return false
+	}
+	raw := rawRequestPath(c)
+	path, err := files.resolve(raw)
+	if err != nil {
+		fm.audit(c, AuditPathRejected, "path", raw, "error", err)
+		fm.respondError(c, http.StatusForbidden, "perm.path_invalid")
+		c.Abort()
+		return false
+	}
+	c.Set("path", path)
+	c.Set("files", files)
+	return true
+}
+
+// 请求中未经解析的 path 参数，查询参数优先
+func rawRequestPath(c *gin.Context) string {
+	if raw := c.Query("path"); raw != "" {
+		return raw
+	}
+	return c.PostForm("path")
+}
+
+// requestPath 中间件解析后的规范路径，相对用户可见的根目录
+func requestPath(c *gin.Context) string {
+	return c.GetString("path")
+}
+
+// 用户可见的根目录，有家目录时为家目录
+func (fm *FileManager) requestFiles(c *gin.Context) *rootFS {
+	if files, ok := c.Get("files"); ok {
+		return files.(*rootFS)
+	}
+	return fm.files
+}
+
+// SetSymlinkPolicy 设置根目录中符号链接的处理方式: follow(默认)、deny、allow
+func (fm *FileManager) SetSymlinkPolicy(policy string) *FileManager {
+	if err := fm.setSymlinkPolicy(policy); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setSymlinkPolicy(policy string) error {
+	if err := validateSymlinkPolicy(policy); err != nil {
+		return err
+	}
+	fm.files.setPolicy(policy)
+	return nil
+}
+
+// 修改符号链接策略，已打开的家目录视图在下次访问时重新打开
+func (r *rootFS) setPolicy(policy string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = policy
+	for _, view := range r.subs {
+		if view.root != nil {
+			view.root.Close()
+		}
+	}
+	r.subs = nil
+	for _, m := range r.mounts {
+		m.setPolicy(policy)
+	}
+}
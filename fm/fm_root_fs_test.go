@@ -0,0 +1,151 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 创建 data/keep/important.txt、指向 data/keep 的 link 和指向根目录外的 outside
+func newSymlinkTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(root, "data", "keep"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(root, "data", "keep", "important.txt"), filepath.Join(outside, "secret.txt")} {
+		if err := os.WriteFile(f, []byte("keep"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join("data", "keep"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "data", "outside")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func assertExists(t *testing.T, name string) {
+	t.Helper()
+	if _, err := os.Lstat(name); err != nil {
+		t.Errorf("%s: %v", name, err)
+	}
+}
+
+func TestRootFSResolveEntry(t *testing.T) {
+	root := newRootFS(newSymlinkTree(t))
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{"link", "link", nil},
+		{"/link/", "link", nil},
+		{"link/important.txt", "data/keep/important.txt", nil},
+		{"data/outside", "data/outside", nil},
+		{"data/outside/secret.txt", "", ErrPathEscape},
+		{"../x", "", ErrPathEscape},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		got, err := root.resolveEntry(tt.path)
+		if got != tt.want || err != tt.err {
+			t.Errorf("resolveEntry(%q) = %q, %v, want %q, %v", tt.path, got, err, tt.want, tt.err)
+		}
+	}
+
+	root.setPolicy(SymlinkDeny)
+	if _, err := root.resolveEntry("link"); err != ErrSymlinkDenied {
+		t.Errorf("resolveEntry(link) with deny = %v, want ErrSymlinkDenied", err)
+	}
+}
+
+// 删除和重命名符号链接只处理链接本身，删除目录时不进入指向根目录外的链接
+func TestRootFSRemoveAndRenameSymlink(t *testing.T) {
+	dir := newSymlinkTree(t)
+	root := newRootFS(dir)
+
+	if err := root.Rename("link", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, filepath.Join(dir, "data", "keep"))
+	if info, err := os.Lstat(filepath.Join(dir, "renamed")); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("renamed is not the symlink: %v", err)
+	}
+
+	if err := root.RemoveAll("renamed"); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, filepath.Join(dir, "data", "keep", "important.txt"))
+
+	if err := root.RemoveAll("data"); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, filepath.Join(filepath.Dir(dir), "outside", "secret.txt"))
+	if _, err := os.Lstat(filepath.Join(dir, "data")); !os.IsNotExist(err) {
+		t.Errorf("data still exists: %v", err)
+	}
+}
+
+// 通过 /file/action 删除或重命名指向目录的符号链接时，链接目标保持不变
+func TestFileActionSymlink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := newSymlinkTree(t)
+	fm := NewFileManager(dir, zap.NewNop()).SetUsers(map[string]User{
+		"admin": {Username: "admin", EncryptPassword: DefaultHashPassword("secret"), Roles: []string{RoleAdmin}},
+	})
+	engine := fm.engine()
+	cookies := testLogin(t, engine, "admin", "secret")
+
+	action := func(values url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/file/action", strings.NewReader(values.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if recorder := action(url.Values{"action": {"rename"}, "path": {"link"}, "new_name": {"renamed"}}); recorder.Code != http.StatusSeeOther {
+		t.Fatalf("rename = %d %s", recorder.Code, recorder.Body)
+	}
+	assertExists(t, filepath.Join(dir, "data", "keep", "important.txt"))
+	assertExists(t, filepath.Join(dir, "renamed"))
+
+	if recorder := action(url.Values{"action": {"delete"}, "path": {"renamed"}}); recorder.Code != http.StatusSeeOther {
+		t.Fatalf("delete = %d %s", recorder.Code, recorder.Body)
+	}
+	assertExists(t, filepath.Join(dir, "data", "keep", "important.txt"))
+	if _, err := os.Lstat(filepath.Join(dir, "renamed")); !os.IsNotExist(err) {
+		t.Errorf("symlink still exists: %v", err)
+	}
+}
+
+// 用户名密码登录，返回会话 cookie
+func testLogin(t *testing.T, engine http.Handler, username, password string) []*http.Cookie {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, "/file/login", strings.NewReader(url.Values{"username": {username}, "password": {password}}.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusSeeOther && recorder.Code != http.StatusFound {
+		t.Fatalf("login = %d %s", recorder.Code, recorder.Body)
+	}
+	return recorder.Result().Cookies()
+}
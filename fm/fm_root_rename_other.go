@@ -0,0 +1,21 @@
+//go:build !unix
+
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Windows、Plan 9、js/wasm、wasip1 上没有相对目录句柄的重命名，先确认所在目录仍在根目录内再按路径重命名
+func renameInRoot(root *os.Root, oldName, newName string) error {
+	for _, name := range []string{oldName, newName} {
+		dir, err := root.Open(filepath.Dir(name))
+		if err != nil {
+			return err
+		}
+		dir.Close()
+	}
+	return os.Rename(filepath.Join(root.Name(), oldName), filepath.Join(root.Name(), newName))
+}
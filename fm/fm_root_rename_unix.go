@@ -0,0 +1,31 @@
+//go:build unix
+
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// 通过 os.Root 打开新旧路径所在的目录，再用 renameat 相对目录句柄重命名，
+// 所在目录被替换为指向根目录外的符号链接时无法打开，最后一级的符号链接只重命名链接本身
+func renameInRoot(root *os.Root, oldName, newName string) error {
+	oldDir, err := root.Open(filepath.Dir(oldName))
+	if err != nil {
+		return err
+	}
+	defer oldDir.Close()
+	newDir, err := root.Open(filepath.Dir(newName))
+	if err != nil {
+		return err
+	}
+	defer newDir.Close()
+
+	if err = unix.Renameat(int(oldDir.Fd()), filepath.Base(oldName), int(newDir.Fd()), filepath.Base(newName)); err != nil {
+		return &os.LinkError{Op: "renameat", Old: oldName, New: newName, Err: err}
+	}
+	return nil
+}
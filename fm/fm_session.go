@@ -0,0 +1,547 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 刷新 token 以固定前缀开头，格式为 fmrt_<会话ID>.<随机值>
+const refreshTokenPrefix = "fmrt_"
+
+// 刷新 token 轮换后，旧 token 在该时间内仍可换取访问 token，避免浏览器并发请求同时刷新时误判为 token 被盗用
+const refreshTokenGracePeriod = 30 * time.Second
+
+var (
+	ErrSessionNotFound = errors.New("会话不存在或已失效")
+	ErrRefreshReused   = errors.New("刷新 token 已被使用，会话已撤销")
+)
+
+// SessionConfig 会话配置，访问 token 过期后浏览器自动用刷新 token 换取新的访问 token
+type SessionConfig struct {
+	AccessTokenTTL  Duration `json:"access_token_ttl"  yaml:"access_token_ttl"  toml:"access_token_ttl"`  // 访问 token(JWT) 的有效期
+	RefreshTokenTTL Duration `json:"refresh_token_ttl" yaml:"refresh_token_ttl" toml:"refresh_token_ttl"` // 刷新 token 的有效期，每次刷新后重新计算，即会话的最长空闲时间
+	Path            string   `json:"path,omitempty"    yaml:"path,omitempty"    toml:"path,omitempty"`    // 保存会话和撤销列表的 JSON 文件，为空时只保存在内存中，重启后需要重新登录；多个实例可以共享同一个文件
+}
+
+// DefaultSessionConfig 默认会话配置
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		AccessTokenTTL:  Duration(15 * time.Minute),
+		RefreshTokenTTL: Duration(10 * time.Hour),
+	}
+}
+
+// Validate 校验会话配置
+func (sc SessionConfig) Validate() error {
+	var errs []error
+	if sc.AccessTokenTTL <= 0 {
+		errs = append(errs, errors.New("session.access_token_ttl: 必须大于 0"))
+	}
+	if sc.RefreshTokenTTL < sc.AccessTokenTTL {
+		errs = append(errs, errors.New("session.refresh_token_ttl: 不能小于 access_token_ttl"))
+	}
+	return errors.Join(errs...)
+}
+
+// session 一次登录产生的会话，退出登录或被撤销后其访问 token 和刷新 token 全部失效
+type session struct {
+	ID                  string    `json:"id"`
+	Username            string    `json:"username"`
+	ClientIP            string    `json:"client_ip"`
+	UserAgent           string    `json:"user_agent"`
+	CreatedAt           time.Time `json:"created_at"`
+	RefreshedAt         time.Time `json:"refreshed_at"`
+	ExpiresAt           time.Time `json:"expires_at"`
+	AccessJTI           string    `json:"access_jti"`        // 最近签发的访问 token
+	AccessExpiresAt     time.Time `json:"access_expires_at"` // 最近签发的访问 token 的过期时间
+	RefreshHash         string    `json:"refresh_hash"`
+	PreviousRefreshHash string    `json:"previous_refresh_hash,omitempty"` // 上一个刷新 token，宽限期后再使用视为被盗用
+	OIDCGroups          []string  `json:"oidc_groups,omitempty"`           // 按组映射的 OIDC 用户登录时的组，每次请求按当前的组映射重新计算权限
+}
+
+// sessionStore 会话和按 jti 撤销的访问 token 列表
+// 设置了文件时每次访问前检查文件是否被修改，修改时持有 path.lock 上的文件锁并重新读取文件，
+// 多个实例共享同一个文件时可以看到彼此创建、刷新和撤销的会话
+type sessionStore struct {
+	mu       sync.Mutex
+	config   SessionConfig
+	sessions map[string]*session
+	revoked  map[string]time.Time // jti -> 访问 token 的过期时间，过期后不再需要记录
+	modTime  time.Time
+	size     int64
+}
+
+// 会话文件格式
+type sessionFile struct {
+	Sessions    []*session           `json:"sessions"`
+	RevokedJTIs map[string]time.Time `json:"revoked_jtis"`
+}
+
+func newSessionStore(config SessionConfig) (*sessionStore, error) {
+	store := &sessionStore{
+		config:   config,
+		sessions: map[string]*session{},
+		revoked:  map[string]time.Time{},
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// 文件修改时间或大小变化时重新读取，调用方需持有锁
+func (ss *sessionStore) load() error {
+	if ss.config.Path == "" {
+		return nil
+	}
+	info, err := os.Stat(ss.config.Path)
+	if os.IsNotExist(err) {
+		clear(ss.sessions)
+		clear(ss.revoked)
+		ss.modTime, ss.size = time.Time{}, 0
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("读取会话文件 %s 失败: %v", ss.config.Path, err)
+	}
+	if info.ModTime().Equal(ss.modTime) && info.Size() == ss.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(ss.config.Path)
+	if err != nil {
+		return fmt.Errorf("读取会话文件 %s 失败: %v", ss.config.Path, err)
+	}
+	var file sessionFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析会话文件 %s 失败: %v", ss.config.Path, err)
+	}
+	ss.sessions = make(map[string]*session, len(file.Sessions))
+	for _, s := range file.Sessions {
+		ss.sessions[s.ID] = s
+	}
+	ss.revoked = maps.Clone(file.RevokedJTIs)
+	if ss.revoked == nil {
+		ss.revoked = map[string]time.Time{}
+	}
+	ss.modTime, ss.size = info.ModTime(), info.Size()
+	ss.prune(time.Now())
+	return nil
+}
+
+// 加锁并读取其他实例的修改，只读的操作使用。读取失败时沿用内存中的数据，返回的函数释放锁
+func (ss *sessionStore) read() func() {
+	ss.mu.Lock()
+	_ = ss.load()
+	return ss.mu.Unlock
+}
+
+// 加锁并在文件锁内重新读取文件，修改后通过 commit 保存，避免覆盖其他实例同时写入的内容。
+// 文件锁或读取失败时仍持有进程内的锁并返回错误，修改只保存在内存中，返回的函数释放锁
+func (ss *sessionStore) write() (func(), error) {
+	ss.mu.Lock()
+	if ss.config.Path == "" {
+		return ss.mu.Unlock, nil
+	}
+	unlockFile, err := lockFile(ss.config.Path)
+	if err != nil {
+		return ss.mu.Unlock, fmt.Errorf("锁定会话文件失败: %v", err)
+	}
+	unlock := func() {
+		unlockFile()
+		ss.mu.Unlock()
+	}
+	ss.modTime, ss.size = time.Time{}, 0
+	return unlock, ss.load()
+}
+
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// 生成刷新 token
+func newRefreshToken(sessionID string) string {
+	return refreshTokenPrefix + sessionID + "." + strings.ToLower(rand.Text())
+}
+
+// 解析刷新 token 中的会话ID
+func refreshTokenSession(token string) (string, bool) {
+	if !strings.HasPrefix(token, refreshTokenPrefix) {
+		return "", false
+	}
+	id, _, ok := strings.Cut(strings.TrimPrefix(token, refreshTokenPrefix), ".")
+	return id, ok && id != ""
+}
+
+// 删除过期的会话和撤销记录，调用方需持有锁
+func (ss *sessionStore) prune(now time.Time) {
+	maps.DeleteFunc(ss.sessions, func(_ string, s *session) bool { return now.After(s.ExpiresAt) })
+	maps.DeleteFunc(ss.revoked, func(_ string, expires time.Time) bool { return now.After(expires) })
+}
+
+// 写入会话文件，调用方需持有锁
+func (ss *sessionStore) save() error {
+	if ss.config.Path == "" {
+		return nil
+	}
+	file := sessionFile{
+		Sessions:    slices.Collect(maps.Values(ss.sessions)),
+		RevokedJTIs: ss.revoked,
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(ss.config.Path, data); err != nil {
+		return err
+	}
+	if info, err := os.Stat(ss.config.Path); err == nil {
+		ss.modTime, ss.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// 修改后清理并保存，保存失败只影响重启后的状态，不影响当前请求
+func (ss *sessionStore) commit(now time.Time) error {
+	ss.prune(now)
+	if err := ss.save(); err != nil {
+		return fmt.Errorf("保存会话文件失败: %v", err)
+	}
+	return nil
+}
+
+// 创建会话，返回会话副本和刷新 token，oidcGroups 只用于按组映射的 OIDC 用户
+func (ss *sessionStore) create(username, clientIP, userAgent string, oidcGroups []string) (session, string, error) {
+	unlock, lockErr := ss.write()
+	defer unlock()
+
+	now := time.Now()
+	s := &session{
+		ID:          strings.ToLower(rand.Text()),
+		Username:    username,
+		ClientIP:    clientIP,
+		UserAgent:   userAgent,
+		CreatedAt:   now,
+		RefreshedAt: now,
+		ExpiresAt:   now.Add(time.Duration(ss.config.RefreshTokenTTL)),
+		OIDCGroups:  oidcGroups,
+	}
+	refresh := newRefreshToken(s.ID)
+	s.RefreshHash = sha256Hex(refresh)
+	ss.sessions[s.ID] = s
+	return *s, refresh, errors.Join(lockErr, ss.commit(now))
+}
+
+// 用刷新 token 换取新的刷新 token，宽限期内重复使用旧 token 时返回空的刷新 token，宽限期后重复使用则撤销整个会话
+func (ss *sessionStore) refresh(token string) (session, string, error) {
+	id, ok := refreshTokenSession(token)
+	if !ok {
+		return session{}, "", ErrSessionNotFound
+	}
+
+	unlock, lockErr := ss.write()
+	defer unlock()
+	now := time.Now()
+	s, ok := ss.sessions[id]
+	if !ok || now.After(s.ExpiresAt) {
+		return session{}, "", ErrSessionNotFound
+	}
+
+	hash := sha256Hex(token)
+	switch {
+	case subtle.ConstantTimeCompare([]byte(hash), []byte(s.RefreshHash)) == 1:
+	case subtle.ConstantTimeCompare([]byte(hash), []byte(s.PreviousRefreshHash)) == 1:
+		if now.Sub(s.RefreshedAt) <= refreshTokenGracePeriod {
+			return *s, "", nil
+		}
+		ss.revokeLocked(s)
+		if err := errors.Join(lockErr, ss.commit(now)); err != nil {
+			return *s, "", errors.Join(ErrRefreshReused, err)
+		}
+		return *s, "", ErrRefreshReused
+	default:
+		return session{}, "", ErrSessionNotFound
+	}
+
+	refresh := newRefreshToken(s.ID)
+	s.PreviousRefreshHash, s.RefreshHash = s.RefreshHash, sha256Hex(refresh)
+	s.RefreshedAt = now
+	s.ExpiresAt = now.Add(time.Duration(ss.config.RefreshTokenTTL))
+	return *s, refresh, errors.Join(lockErr, ss.commit(now))
+}
+
+// 按刷新 token 查找会话，不轮换 token
+func (ss *sessionStore) find(token string) (session, bool) {
+	id, ok := refreshTokenSession(token)
+	if !ok {
+		return session{}, false
+	}
+	defer ss.read()()
+	s, ok := ss.sessions[id]
+	if !ok || time.Now().After(s.ExpiresAt) || subtle.ConstantTimeCompare([]byte(sha256Hex(token)), []byte(s.RefreshHash)) != 1 {
+		return session{}, false
+	}
+	return *s, true
+}
+
+// 记录会话最近签发的访问 token，撤销会话时一并加入撤销列表
+func (ss *sessionStore) setAccessToken(id, jti string, expires time.Time) error {
+	unlock, lockErr := ss.write()
+	defer unlock()
+	s, ok := ss.sessions[id]
+	if !ok {
+		return lockErr
+	}
+	s.AccessJTI, s.AccessExpiresAt = jti, expires
+	return errors.Join(lockErr, ss.commit(time.Now()))
+}
+
+// 判断访问 token 是否有效：jti 未被撤销且所属会话仍然存在，有效时返回会话副本
+func (ss *sessionStore) active(id, jti string) (session, bool) {
+	defer ss.read()()
+	if _, revoked := ss.revoked[jti]; revoked {
+		return session{}, false
+	}
+	s, ok := ss.sessions[id]
+	if !ok || !time.Now().Before(s.ExpiresAt) {
+		return session{}, false
+	}
+	return *s, true
+}
+
+// 撤销会话，调用方需持有锁
+func (ss *sessionStore) revokeLocked(s *session) {
+	if s.AccessJTI != "" {
+		ss.revoked[s.AccessJTI] = s.AccessExpiresAt
+	}
+	delete(ss.sessions, s.ID)
+}
+
+// 撤销单个访问 token 及其所属会话，返回被撤销的会话
+func (ss *sessionStore) revoke(id, jti string, expires time.Time) (session, error) {
+	unlock, lockErr := ss.write()
+	defer unlock()
+	if jti != "" {
+		ss.revoked[jti] = expires
+	}
+	s, ok := ss.sessions[id]
+	if ok {
+		ss.revokeLocked(s)
+	}
+	err := errors.Join(lockErr, ss.commit(time.Now()))
+	if !ok {
+		return session{}, cmp.Or(err, ErrSessionNotFound)
+	}
+	return *s, err
+}
+
+// 撤销用户的所有会话，返回撤销的数量
+func (ss *sessionStore) revokeUser(username string) (int, error) {
+	unlock, lockErr := ss.write()
+	defer unlock()
+	count := 0
+	for _, s := range ss.sessions {
+		if s.Username == username {
+			ss.revokeLocked(s)
+			count++
+		}
+	}
+	return count, errors.Join(lockErr, ss.commit(time.Now()))
+}
+
+// 按用户名和创建时间列出有效的会话，username 为空时列出所有用户的会话
+func (ss *sessionStore) list(username string) []session {
+	defer ss.read()()
+	now := time.Now()
+	var sessions []session
+	for _, s := range ss.sessions {
+		if now.Before(s.ExpiresAt) && (username == "" || s.Username == username) {
+			sessions = append(sessions, *s)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b session) int {
+		return cmp.Or(cmp.Compare(a.Username, b.Username), b.CreatedAt.Compare(a.CreatedAt))
+	})
+	return sessions
+}
+
+// SetSession 设置访问 token、刷新 token 的有效期和会话文件
+func (fm *FileManager) SetSession(config SessionConfig) *FileManager {
+	if err := fm.setSession(config); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setSession(config SessionConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	sessions, err := newSessionStore(config)
+	if err != nil {
+		return err
+	}
+	fm.sessions = sessions
+	fm.maxAge = int(time.Duration(config.RefreshTokenTTL).Seconds())
+	return nil
+}
+
+// RevokeSessions 撤销用户的所有会话，返回撤销的数量，用于删除用户或重置密码后强制重新登录
+func (fm *FileManager) RevokeSessions(username string) int {
+	count, err := fm.sessions.revokeUser(username)
+	if err != nil {
+		fm.log.Warn(err)
+	}
+	return count
+}
+
+// 用刷新 token 换取新的访问 token 和刷新 token，供无法使用 cookie 的客户端调用
+func (fm *FileManager) handleTokenRefresh(c *gin.Context) {
+	refresh := c.PostForm("refresh_token")
+	if refresh == "" {
+		refresh, _ = c.Cookie(fm.refreshCookieName())
+	}
+	s, newRefresh, err := fm.sessions.refresh(refresh)
+	switch {
+	case errors.Is(err, ErrRefreshReused):
+		fm.audit(c, AuditSessionRefreshReused, "username", s.Username, "session_id", s.ID)
+		fallthrough
+	case errors.Is(err, ErrSessionNotFound):
+		fm.clearSessionCookies(c)
+		fm.respondError(c, http.StatusUnauthorized, "session.expired")
+		return
+	case err != nil:
+		fm.log.Warn(err)
+	}
+	if err = fm.setSessionCookies(c, s, newRefresh); err != nil {
+		fm.log.Warn("生成JWT token失败,报错: ", err)
+		fm.respondError(c, http.StatusInternalServerError, "login.error.failed")
+		return
+	}
+	token, _ := c.Cookie(fm.cookieName)
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": newRefresh, // 宽限期内重复刷新时为空，继续使用已有的刷新 token
+		"expires_in":    int(time.Duration(fm.sessions.config.AccessTokenTTL).Seconds()),
+	})
+}
+
+// 退出所有设备上的登录
+func (fm *FileManager) handleLogoutAll(c *gin.Context) {
+	user, ok := fm.currentUser(c)
+	if !ok {
+		c.Redirect(http.StatusSeeOther, "/file/login")
+		return
+	}
+	count := fm.RevokeSessions(user.Username)
+	fm.audit(c, AuditSessionRevokedAll, "username", user.Username, "sessions", count)
+	fm.clearSessionCookies(c)
+
+	if c.GetHeader("Content-Type") == "application/json" {
+		c.JSON(http.StatusOK, gin.H{"message": fm.t(c, "logout.success"), "sessions": count})
+		return
+	}
+	c.Set("user", fm.guest())
+	c.Redirect(http.StatusSeeOther, "/file/login")
+}
+
+// 会话列表中的一项
+type sessionEntry struct {
+	ID          string
+	Username    string
+	ClientIP    string
+	UserAgent   string
+	CreatedAt   string
+	RefreshedAt string
+	ExpiresAt   string
+	Current     bool
+}
+
+func (fm *FileManager) renderSessions(c *gin.Context, user User, admin bool) {
+	username := user.Username
+	if admin {
+		username = ""
+	}
+	data := sessionPageData{pageData: fm.newPageData(c, user), Admin: admin}
+	current := c.GetString("sessionID")
+	for _, s := range fm.sessions.list(username) {
+		data.Sessions = append(data.Sessions, sessionEntry{
+			ID:          s.ID,
+			Username:    s.Username,
+			ClientIP:    s.ClientIP,
+			UserAgent:   s.UserAgent,
+			CreatedAt:   s.CreatedAt.Local().Format(time.DateTime),
+			RefreshedAt: s.RefreshedAt.Local().Format(time.DateTime),
+			ExpiresAt:   s.ExpiresAt.Local().Format(time.DateTime),
+			Current:     s.ID == current,
+		})
+	}
+	fm.renderHTML(c, http.StatusOK, templateSessions, data)
+}
+
+// 当前用户的会话
+func (fm *FileManager) showSessions(c *gin.Context) {
+	user, ok := fm.currentUser(c)
+	if !ok {
+		c.Redirect(http.StatusSeeOther, "/file/login")
+		return
+	}
+	fm.renderSessions(c, user, false)
+}
+
+// 撤销当前用户的一个会话
+func (fm *FileManager) handleSessionRevoke(c *gin.Context) {
+	user, ok := fm.currentUser(c)
+	if !ok {
+		c.Redirect(http.StatusSeeOther, "/file/login")
+		return
+	}
+	id := c.PostForm("id")
+	if slices.ContainsFunc(fm.sessions.list(user.Username), func(s session) bool { return s.ID == id }) {
+		fm.revokeSessionByID(c, id)
+	}
+	c.Redirect(http.StatusSeeOther, "/file/settings/sessions")
+}
+
+func (fm *FileManager) revokeSessionByID(c *gin.Context, id string) {
+	s, err := fm.sessions.revoke(id, "", time.Time{})
+	if s.ID != "" {
+		fm.audit(c, AuditSessionRevoked, "username", s.Username, "session_id", s.ID)
+	}
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		fm.log.Warn(err)
+	}
+}
+
+// 管理员查看所有用户的会话
+func (fm *FileManager) showAdminSessions(c *gin.Context) {
+	user, _ := fm.currentUser(c)
+	fm.renderSessions(c, user, true)
+}
+
+// 管理员撤销指定会话或指定用户的所有会话
+func (fm *FileManager) handleAdminSessionRevoke(c *gin.Context) {
+	if id := c.PostForm("id"); id != "" {
+		fm.revokeSessionByID(c, id)
+	} else if username := c.PostForm("username"); username != "" {
+		count := fm.RevokeSessions(username)
+		fm.audit(c, AuditSessionRevokedAll, "username", username, "sessions", count)
+	}
+	c.Redirect(http.StatusSeeOther, "/file/admin/sessions")
+}
@@ -0,0 +1,86 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSharedSessionStores(t *testing.T, count int) []*sessionStore {
+	t.Helper()
+	config := SessionConfig{
+		AccessTokenTTL:  Duration(time.Minute),
+		RefreshTokenTTL: Duration(time.Hour),
+		Path:            filepath.Join(t.TempDir(), "sessions.json"),
+	}
+	stores := make([]*sessionStore, count)
+	for i := range stores {
+		store, err := newSessionStore(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores[i] = store
+	}
+	return stores
+}
+
+// 共享会话文件的实例可以看到彼此创建、刷新和撤销的会话
+func TestSessionStoreShared(t *testing.T) {
+	stores := newSharedSessionStores(t, 2)
+	a, b := stores[0], stores[1]
+
+	s, refresh, err := a.create("alice", "127.0.0.1", "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.setAccessToken(s.ID, "jti-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.active(s.ID, "jti-1"); !ok {
+		t.Fatal("session created on a is not active on b")
+	}
+
+	_, rotated, err := b.refresh(refresh)
+	if err != nil || rotated == "" {
+		t.Fatalf("refresh on b = %q, %v", rotated, err)
+	}
+	if _, ok := a.find(rotated); !ok {
+		t.Fatal("token rotated on b is unknown to a")
+	}
+
+	if _, err = a.revoke(s.ID, "jti-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.active(s.ID, "jti-1"); ok {
+		t.Fatal("session revoked on a is still active on b")
+	}
+}
+
+// 多个实例同时创建会话不会覆盖对方写入的会话
+func TestSessionStoreSharedWriters(t *testing.T) {
+	stores := newSharedSessionStores(t, 2)
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				if _, _, err := store.create(fmt.Sprintf("user-%d-%d", i, j), "127.0.0.1", "test", nil); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	reader, err := newSessionStore(stores[0].config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(reader.list("")); got != 40 {
+		t.Fatalf("sessions = %d, want 40", got)
+	}
+}
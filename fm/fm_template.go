@@ -0,0 +1,299 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 内置页面模板和静态资源，html/template 会根据上下文自动转义文件名、路径等用户可控内容
+//
+//go:embed templates/*.html static locales
+var defaultUIFS embed.FS
+
+// 模板名称
+const (
+	templateLogin       = "login.html"
+	templateError       = "error.html"
+	templateFileManager = "file_manager.html"
+	templateFileViewer  = "file_viewer.html"
+	templateFileEditor  = "file_editor.html"
+
+	templateTOTPLogin    = "login_totp.html"
+	templateTOTPSettings = "settings_totp.html"
+	templateAPITokens    = "settings_tokens.html"
+	templateSessions     = "sessions.html"
+	templateMaintenance  = "maintenance.html"
+	templateAdminMode    = "admin_mode.html"
+)
+
+// 主题
+const (
+	ThemeLight = "light" // 浅色
+	ThemeDark  = "dark"  // 深色
+	ThemeAuto  = "auto"  // 跟随浏览器的配色偏好
+)
+
+const (
+	templatePattern = "templates/*.html"
+	staticDir       = "static"
+)
+
+// overlayFS 优先从自定义目录读取，不存在时回退到内置资源
+type overlayFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if o.upper != nil {
+		if file, err := o.upper.Open(name); err == nil {
+			return file, nil
+		}
+	}
+	return o.lower.Open(name)
+}
+
+// 解析模板，自定义模板中的同名文件或同名 define 覆盖内置模板
+func parseTemplates(custom fs.FS) (*template.Template, error) {
+	templates, err := template.New("").ParseFS(defaultUIFS, templatePattern)
+	if err != nil {
+		return nil, err
+	}
+	if custom == nil {
+		return templates, nil
+	}
+
+	matches, err := fs.Glob(custom, templatePattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return templates, nil
+	}
+	return templates.ParseFS(custom, templatePattern)
+}
+
+// pageData 所有页面共用的数据
+type pageData struct {
+	SiteName string
+	LogoURL  string
+	Theme    string
+	Locale   string
+	Locales  []localeOption
+	User     User
+	IsGuest  bool
+	IsAdmin  bool
+	Roles    string // 逗号分隔的角色名，用于显示
+	Banner   string // 页面顶部的只读或维护模式提示
+	messages *messageCatalog
+}
+
+func (fm *FileManager) newPageData(c *gin.Context, user User) pageData {
+	locale := fm.localeOf(c)
+	siteName := fm.siteName
+	if siteName == "" {
+		siteName = fm.messages.translate(locale, "site.name")
+	}
+	return pageData{
+		SiteName: siteName,
+		LogoURL:  fm.logoURL,
+		Theme:    fm.theme,
+		Locale:   locale,
+		Locales:  fm.localeOptions(c),
+		User:     user,
+		IsGuest:  user.Username == fm.users.guest().Username,
+		IsAdmin:  user.IsAdmin(),
+		Roles:    strings.Join(user.EffectiveRoles(), ", "),
+		Banner:   fm.modeBanner(c, user),
+		messages: fm.messages,
+	}
+}
+
+// T 在模板中按页面语言翻译消息，如 {{.T "dir.refresh"}}
+func (p pageData) T(key string, args ...any) string {
+	return p.messages.translate(p.Locale, key, args...)
+}
+
+// 错误页面
+type errorPageData struct {
+	pageData
+	Message string
+}
+
+// 登录页面
+type loginPageData struct {
+	pageData
+	Error      string
+	LocalLogin bool // 是否显示用户名密码表单
+	SSO        bool // 是否显示单点登录入口
+}
+
+// 两步验证登录页面
+type totpLoginPageData struct {
+	pageData
+	Error string
+}
+
+// 两步验证设置页面
+type totpSettingsPageData struct {
+	pageData
+	Enabled        bool
+	RemainingCodes int          // 剩余的恢复码数量
+	Secret         string       // 未启用时新生成的密钥，供无法扫码时手动输入
+	URI            string       // otpauth:// 配置地址
+	QRCode         template.URL // 配置地址的二维码
+	RecoveryCodes  []string     // 刚生成的恢复码明文，只显示一次
+	Error          string
+}
+
+// API token 设置页面
+type apiTokenPageData struct {
+	pageData
+	Tokens      []apiTokenEntry
+	Permissions []apiTokenOption // 用户拥有的权限，token 只能选择其中的一部分
+	Expiries    []apiTokenOption
+	Created     string // 刚创建的 token 明文，只显示一次
+	Error       string
+}
+
+// 会话页面，管理员页面列出所有用户的会话
+type sessionPageData struct {
+	pageData
+	Admin    bool
+	Sessions []sessionEntry
+}
+
+// fileEntry 目录列表中的一项
+type fileEntry struct {
+	Name         string
+	Path         string
+	Type         string
+	Size         string
+	ModTime      string
+	IsDir        bool
+	IsHidden     bool
+	HasThumbnail bool
+	CanView      bool
+	CanDownload  bool
+	CanEdit      bool
+	CanRename    bool
+	CanDelete    bool
+}
+
+// 目录页面
+type dirPageData struct {
+	pageData
+	Path             string
+	ParentPath       string
+	ParentVisible    bool
+	ViewMode         string
+	ThumbnailSize    int
+	GalleryItemWidth int
+	MaxUploadSize    string
+	ReadOnly         bool
+	CanUpload        bool
+	CanCreate        bool
+	CanRename        bool
+	Entries          []fileEntry
+	ReadError        string
+}
+
+// 文件查看/编辑页面
+type filePageData struct {
+	pageData
+	Path        string
+	ParentPath  string
+	FileName    string
+	HasInfo     bool
+	Size        string
+	ModTime     string
+	Encoding    string
+	LineEnding  string
+	Encodings   []string
+	LineEndings []string
+	Content     string
+	ReadError   string
+	CanDownload bool
+	CanEdit     bool
+}
+
+// 渲染页面，先写入缓冲区，模板执行失败时返回500而不是半个页面
+func (fm *FileManager) renderHTML(c *gin.Context, status int, name string, data any) {
+	var buf bytes.Buffer
+	if err := fm.templates.ExecuteTemplate(&buf, name, data); err != nil {
+		fm.log.Errorf("渲染页面 %s 失败: %v", name, err)
+		c.String(http.StatusInternalServerError, fm.t(c, "error.render"))
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// SetTemplates 设置自定义页面模板和静态资源，目录结构与内置资源一致:
+// templates/*.html 覆盖同名页面或片段，static/ 下的文件覆盖同名样式，
+// 例如 static/themes/<name>.css 可新增主题，locales/<语言>.json 覆盖或新增翻译。
+// 解析失败时保留原有模板
+func (fm *FileManager) SetTemplates(fsys fs.FS) *FileManager {
+	if err := fm.setTemplates(fsys); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setTemplates(fsys fs.FS) error {
+	templates, err := parseTemplates(fsys)
+	if err != nil {
+		return fmt.Errorf("解析自定义模板失败: %v", err)
+	}
+	messages, err := loadMessageCatalog(fm.messages.defaultLocale, defaultUIFS, fsys)
+	if err != nil {
+		return fmt.Errorf("加载自定义语言文件失败: %v", err)
+	}
+	fm.templates = templates
+	fm.messages = messages
+	fm.customUIFS = fsys
+	fm.uiFS = overlayFS{upper: fsys, lower: defaultUIFS}
+	return nil
+}
+
+// SetTheme 设置页面主题，可选 light、dark、auto 或自定义模板中 static/themes 下的主题
+func (fm *FileManager) SetTheme(theme string) *FileManager {
+	if err := fm.setTheme(theme); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setTheme(theme string) error {
+	if theme != ThemeAuto {
+		if _, err := fs.Stat(fm.uiFS, staticDir+"/themes/"+theme+".css"); err != nil {
+			return fmt.Errorf("主题 %s 不存在: %v", theme, err)
+		}
+	}
+	fm.theme = theme
+	return nil
+}
+
+// SetBranding 设置站点名称和Logo地址，logoURL 为空时不显示Logo
+func (fm *FileManager) SetBranding(siteName, logoURL string) *FileManager {
+	fm.siteName = siteName
+	fm.logoURL = logoURL
+	return fm
+}
+
+// 静态资源
+func (fm *FileManager) handleStatic(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("filepath"), "/")
+	if !fs.ValidPath(name) {
+		c.String(http.StatusNotFound, fm.t(c, "error.not_found"))
+		return
+	}
+	c.FileFromFS(staticDir+"/"+name, http.FS(fm.uiFS))
+}
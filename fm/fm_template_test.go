@@ -0,0 +1,61 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 文件名和路径在列表、查看页面的文本、属性和链接中都被转义
+func TestTemplateEscapesNames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	names := []string{
+		`<img src=x onerror=alert(1)>.txt`,
+		`a" onmouseover="alert(1).txt`,
+		`b' onclick='alert(1).txt`,
+		`<i onclick=x>dir/c.txt`,
+	}
+	writeTestFiles(t, dir, names...)
+	fm := NewFileManager(dir, zap.NewNop()).SetUsers(map[string]User{
+		"admin": {Username: "admin", EncryptPassword: DefaultHashPassword("secret"), Roles: []string{RoleAdmin}},
+	})
+	engine := fm.engine()
+	cookies := testLogin(t, engine, "admin", "secret")
+
+	tests := []struct {
+		name    string
+		path    string
+		raw     []string
+		escaped []string
+	}{
+		{"directory listing", "", []string{`<img src=x`, `" onmouseover="`, `' onclick='`, `<i onclick`}, []string{`&lt;img src=x onerror=alert(1)&gt;.txt`, `&lt;i onclick=x&gt;dir/`}},
+		{"directory title", "<i onclick=x>dir", []string{`<i onclick`}, []string{`&lt;i onclick=x&gt;dir`}},
+		{"file viewer", names[0], []string{`<img src=x`}, []string{`&lt;img src=x onerror=alert(1)&gt;.txt`}},
+		{"attribute quote", names[1], []string{`" onmouseover="`}, []string{`&#34; onmouseover=&#34;`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serveTest(engine, http.MethodGet, "/file?path="+url.QueryEscape(tt.path), cookies)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+			body := recorder.Body.String()
+			for _, raw := range tt.raw {
+				if strings.Contains(body, raw) {
+					t.Errorf("page contains unescaped %q", raw)
+				}
+			}
+			for _, escaped := range tt.escaped {
+				if !strings.Contains(body, escaped) {
+					t.Errorf("page does not contain escaped %q", escaped)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"bytes"
+	"container/list"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+)
+
+const (
+	defaultThumbnailSize      = 200      // 缩略图默认边长(像素)
+	defaultThumbnailCacheSize = 64 << 20 // 缩略图缓存默认上限 64MB
+	maxThumbnailSourceSize    = 64 << 20 // 超过该大小的图片不生成缩略图
+	maxThumbnailSourcePixels  = 50 << 20 // 超过该像素数的图片不生成缩略图，防止解码炸弹
+)
+
+// 目录展示模式
+const (
+	ViewModeList    = "list"    // 列表
+	ViewModeGallery = "gallery" // 网格/画廊
+)
+
+// 支持生成缩略图的图片扩展名
+var thumbnailExtensions = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+}
+
+// 判断是否为可生成缩略图的图片
+func isImageFile(name string) bool {
+	return thumbnailExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+type thumbnailEntry struct {
+	key     string
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// thumbnailCache 以文件路径为键的LRU缓存，源文件修改时间或大小变化后自动失效
+type thumbnailCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+func newThumbnailCache(maxBytes int64) *thumbnailCache {
+	return &thumbnailCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// 获取缓存，源文件已变化时删除旧缓存
+func (tc *thumbnailCache) get(key string, modTime time.Time, size int64) ([]byte, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	elem, ok := tc.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*thumbnailEntry)
+	if !entry.modTime.Equal(modTime) || entry.size != size {
+		tc.removeElement(elem)
+		return nil, false
+	}
+	tc.ll.MoveToFront(elem)
+	return entry.data, true
+}
+
+// 写入缓存，超出上限时淘汰最久未使用的条目
+func (tc *thumbnailCache) put(key string, modTime time.Time, size int64, data []byte) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if int64(len(data)) > tc.maxBytes {
+		return
+	}
+	if elem, ok := tc.items[key]; ok {
+		tc.removeElement(elem)
+	}
+	elem := tc.ll.PushFront(&thumbnailEntry{key: key, modTime: modTime, size: size, data: data})
+	tc.items[key] = elem
+	tc.curBytes += int64(len(data))
+
+	for tc.curBytes > tc.maxBytes {
+		oldest := tc.ll.Back()
+		if oldest == nil {
+			break
+		}
+		tc.removeElement(oldest)
+	}
+}
+
+func (tc *thumbnailCache) setMaxBytes(maxBytes int64) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.maxBytes = maxBytes
+	for tc.curBytes > tc.maxBytes {
+		oldest := tc.ll.Back()
+		if oldest == nil {
+			break
+		}
+		tc.removeElement(oldest)
+	}
+}
+
+func (tc *thumbnailCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*thumbnailEntry)
+	tc.ll.Remove(elem)
+	delete(tc.items, entry.key)
+	tc.curBytes -= int64(len(entry.data))
+}
+
+// 生成缩略图，输出为JPEG
+func generateThumbnail(files *rootFS, path string, maxSide int) ([]byte, error) {
+	file, err := files.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, newMessageError("thumbnail.unknown_format", err)
+	}
+	if config.Width*config.Height > maxThumbnailSourcePixels {
+		return nil, newMessageError("thumbnail.too_many_pixels", config.Width, config.Height)
+	}
+
+	if _, err = file.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, newMessageError("thumbnail.decode_failed", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			height = max(1, height*maxSide/width)
+			width = maxSide
+		} else {
+			width = max(1, width*maxSide/height)
+			height = maxSide
+		}
+	}
+
+	// 透明区域以白色填充
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 缩略图
+func (fm *FileManager) handleThumbnail(c *gin.Context) {
+	path := requestPath(c)
+	root := fm.requestFiles(c)
+
+	fileInfo, err := root.Stat(path)
+	if err != nil {
+		fm.respondError(c, http.StatusNotFound, "file.not_exist", err)
+		return
+	}
+	if fileInfo.IsDir() || !isImageFile(fileInfo.Name()) {
+		fm.respondError(c, http.StatusBadRequest, "thumbnail.unsupported")
+		return
+	}
+	if fileInfo.Size() > maxThumbnailSourceSize {
+		fm.respondError(c, http.StatusBadRequest, "thumbnail.too_large")
+		return
+	}
+
+	data, ok := fm.thumbnails.get(root.localPath(path), fileInfo.ModTime(), fileInfo.Size())
+	if !ok {
+		if data, err = generateThumbnail(root, path, fm.thumbnailSize); err != nil {
+			fm.respondError(c, http.StatusUnprocessableEntity, "thumbnail.failed", err)
+			return
+		}
+		fm.thumbnails.put(root.localPath(path), fileInfo.ModTime(), fileInfo.Size(), data)
+	}
+
+	c.Header("Cache-Control", "private, max-age=60")
+	c.Header("Last-Modified", fileInfo.ModTime().UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, "image/jpeg", data)
+}
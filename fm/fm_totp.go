@@ -0,0 +1,506 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+// TOTP 参数，与 Google Authenticator 等常见应用的默认值一致(RFC 6238)
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpModulo        = 1000000 // 10^totpDigits
+	totpSkew          = 1       // 允许前后各一个周期的时钟偏差
+	totpSecretSize    = 20      // 密钥字节数
+	recoveryCodeCount = 10
+	totpLoginMaxAge   = 300 // 密码校验通过后输入验证码的时限(秒)
+	totpEnrollMaxAge  = 600 // 绑定时新密钥的有效期(秒)
+	totpQRCodeSize    = 200
+)
+
+// 两步验证相关的页面错误码
+const (
+	totpErrorCode        = "code"
+	totpErrorUnsupported = "unsupported"
+	totpErrorFailed      = "failed"
+)
+
+var totpErrorMessages = map[string]string{
+	totpErrorCode:        "totp.error.code",
+	totpErrorUnsupported: "totp.error.unsupported",
+	totpErrorFailed:      "totp.error.failed",
+	loginErrorLocked:     "login.error.locked",
+}
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret 生成随机的 base32 密钥
+func GenerateTOTPSecret() string {
+	secret := make([]byte, totpSecretSize)
+	_, _ = rand.Read(secret)
+	return base32NoPadding.EncodeToString(secret)
+}
+
+// 解码 base32 密钥，忽略大小写、空格和填充
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return base32NoPadding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+func validateTOTPSecret(secret string) error {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return fmt.Errorf("不是合法的 base32: %v", err)
+	}
+	if len(key) < 10 {
+		return errors.New("密钥至少需要 80 位")
+	}
+	return nil
+}
+
+// 按 RFC 4226 计算指定计数器的验证码
+func totpCode(key []byte, counter uint64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo)
+}
+
+// 校验验证码，返回匹配的计数器
+func matchTOTP(secret, code string, now time.Time) (uint64, bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := uint64(now.Unix() / totpPeriod)
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		counter := current + uint64(offset)
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// 生成 otpauth:// 格式的配置地址，验证器应用扫描二维码后自动添加账户
+func totpURI(issuer, username, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totpDigits))
+	values.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// 将内容编码为 PNG 二维码的 data URI
+func qrCodeDataURI(content string) (template.URL, error) {
+	png, err := qrcode.Encode(content, qrcode.Medium, totpQRCodeSize)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)), nil
+}
+
+// 生成一组恢复码，返回明文和保存用的哈希
+func generateRecoveryCodes() (codes []string, hashes []string) {
+	for range recoveryCodeCount {
+		text := strings.ToLower(rand.Text())
+		code := text[:5] + "-" + text[5:10]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes
+}
+
+// 恢复码是高熵随机值，使用 SHA-256 即可，忽略大小写、空格和连字符
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func isRecoveryCodeHash(hash string) bool {
+	_, err := hex.DecodeString(hash)
+	return err == nil && len(hash) == sha256.Size*2
+}
+
+// totpReplayGuard 记录每个用户最后使用的验证码周期，同一个验证码只能使用一次
+type totpReplayGuard struct {
+	mu   sync.Mutex
+	used map[string]uint64
+}
+
+func newTOTPReplayGuard() *totpReplayGuard {
+	return &totpReplayGuard{used: map[string]uint64{}}
+}
+
+// 校验验证码并标记为已使用
+func (tg *totpReplayGuard) verify(username, secret, code string) bool {
+	counter, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return false
+	}
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+	if last, exists := tg.used[username]; exists && counter <= last {
+		return false
+	}
+	tg.used[username] = counter
+	return true
+}
+
+// 第二步验证方式
+const (
+	secondFactorTOTP         = "totp"
+	secondFactorRecoveryCode = "recovery_code"
+)
+
+// 校验验证码或恢复码，使用恢复码时将其从用户存储中删除
+func (fm *FileManager) verifySecondFactor(user User, code string) (string, bool) {
+	code = strings.TrimSpace(code)
+	if fm.totpGuard.verify(user.Username, user.TOTPSecret, strings.ReplaceAll(code, " ", "")) {
+		return secondFactorTOTP, true
+	}
+
+	err := fm.consumeRecoveryCode(user.Username, hashRecoveryCode(code))
+	if errors.Is(err, errRecoveryCodeNotFound) {
+		return "", false
+	} else if err != nil {
+		fm.log.Errorf("删除用户 %s 已使用的恢复码失败: %v", user.Username, err)
+		return "", false
+	}
+	return secondFactorRecoveryCode, true
+}
+
+var errRecoveryCodeNotFound = errors.New("恢复码不存在或已使用")
+
+// recoveryCodeStore 可以原子地检查并删除恢复码的用户存储，并发请求中同一个恢复码只有一个能成功
+type recoveryCodeStore interface {
+	consumeRecoveryCode(username, hash string) error
+}
+
+// 删除用户的恢复码，恢复码不存在时返回 errRecoveryCodeNotFound。
+// 存储不支持原子删除时在本进程内按用户串行读取和更新
+func (fm *FileManager) consumeRecoveryCode(username, hash string) error {
+	if store, ok := fm.userStore.(recoveryCodeStore); ok {
+		return store.consumeRecoveryCode(username, hash)
+	}
+
+	value, _ := fm.userLocks.LoadOrStore(username, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+
+	user, err := fm.userStore.Lookup(username)
+	if err != nil {
+		return err
+	}
+	codes, ok := removeRecoveryCode(user.RecoveryCodes, hash)
+	if !ok {
+		return errRecoveryCodeNotFound
+	}
+	user.RecoveryCodes = codes
+	return fm.userStore.Update(user)
+}
+
+// 以常量时间查找恢复码的哈希，返回删除后的副本
+func removeRecoveryCode(codes []string, hash string) ([]string, bool) {
+	index := slices.IndexFunc(codes, func(stored string) bool {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1
+	})
+	if index < 0 {
+		return codes, false
+	}
+	return slices.Delete(slices.Clone(codes), index, index+1), true
+}
+
+// 验证器应用中显示的发行方名称
+func (fm *FileManager) totpIssuer() string {
+	if fm.siteName != "" {
+		return fm.siteName
+	}
+	return "fileManager"
+}
+
+func (fm *FileManager) totpLoginCookie() string {
+	return fm.cookieName + "_totp"
+}
+
+// 密码或 OIDC 校验通过后签发只能用于两步验证的临时 token，浏览器跳转到验证码页面，method 为第一步的登录方式
+func (fm *FileManager) startTOTPLogin(c *gin.Context, username, method string) {
+	token, err := fm.signJWTToken(JWTClaims{Username: username, Purpose: tokenPurposeTOTP, Method: method}, totpLoginMaxAge*time.Second)
+	if err != nil {
+		fm.log.Warn("生成JWT token失败,报错: ", err)
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorFailed)
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     fm.totpLoginCookie(),
+		Value:    token,
+		Path:     "/file/login/2fa",
+		MaxAge:   totpLoginMaxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if c.GetHeader("Content-Type") == "application/json" {
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor": true,
+			"totp_token": token,
+			"message":    fm.t(c, "totp.login.required"),
+		})
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/file/login/2fa")
+}
+
+// 读取两步验证临时 token 中的用户名和第一步的登录方式，JSON 客户端可以通过 totp_token 参数传递
+func (fm *FileManager) pendingTOTPUser(c *gin.Context) (string, string, bool) {
+	token := c.PostForm("totp_token")
+	if token == "" {
+		token, _ = c.Cookie(fm.totpLoginCookie())
+	}
+	claims, err := fm.parseJWTToken(token, tokenPurposeTOTP)
+	if err != nil {
+		return "", "", false
+	}
+	return claims.Username, cmp.Or(claims.Method, "password"), true
+}
+
+// 两步验证页面
+func (fm *FileManager) showTOTPLogin(c *gin.Context) {
+	if _, _, ok := fm.pendingTOTPUser(c); !ok {
+		c.Redirect(http.StatusSeeOther, "/file/login")
+		return
+	}
+	data := totpLoginPageData{pageData: fm.newPageData(c, fm.guest())}
+	if key, ok := totpErrorMessages[c.Query("error")]; ok {
+		data.Error = fm.t(c, key)
+	}
+	fm.renderHTML(c, http.StatusOK, templateTOTPLogin, data)
+}
+
+// 校验两步验证码，通过后签发会话 token
+func (fm *FileManager) handleTOTPLogin(c *gin.Context) {
+	username, firstFactor, ok := fm.pendingTOTPUser(c)
+	if !ok {
+		c.Redirect(http.StatusSeeOther, "/file/login")
+		return
+	}
+	clientIP := c.ClientIP()
+	if wait, ok := fm.loginLimiter.allow(clientIP, username); !ok {
+		fm.audit(c, AuditLoginBlocked, "username", username, "retry_after", wait.Round(time.Second).String())
+		setRetryAfter(c, wait)
+		c.Redirect(http.StatusSeeOther, "/file/login/2fa?error="+loginErrorLocked)
+		return
+	}
+
+	user, err := fm.userStore.Lookup(username)
+	if err != nil || user.TOTPSecret == "" {
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorFailed)
+		return
+	}
+	method, ok := fm.verifySecondFactor(user, c.PostForm("code"))
+	if !ok {
+		fm.audit(c, AuditTOTPFailure, "username", username)
+		if fm.loginLimiter.fail(clientIP, username) {
+			fm.audit(c, AuditLoginLocked, "username", username)
+		}
+		c.Redirect(http.StatusSeeOther, "/file/login/2fa?error="+totpErrorCode)
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{Name: fm.totpLoginCookie(), Path: "/file/login/2fa", MaxAge: -1})
+	fm.loginLimiter.succeed(username)
+	if err = fm.issueSession(c, username, nil); err != nil {
+		fm.log.Warn("生成JWT token失败,报错: ", err)
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorFailed)
+		return
+	}
+	c.Set("user", user)
+	fm.audit(c, AuditLoginSuccess, "username", username, "method", firstFactor+"+"+method)
+	fm.respondLogin(c, username)
+}
+
+func (fm *FileManager) totpEnrollCookie() string {
+	return fm.cookieName + "_totp_enroll"
+}
+
+// 当前通过会话登录的用户，游客和通过 API token 访问时返回 false
+func (fm *FileManager) currentUser(c *gin.Context) (User, bool) {
+	value, exists := c.Get("user")
+	user, ok := value.(User)
+	if !exists || !ok || user.Username == fm.users.guest().Username || c.GetString("apiToken") != "" {
+		return User{}, false
+	}
+	return user, true
+}
+
+// 两步验证设置页面，未启用时生成新密钥并显示二维码
+func (fm *FileManager) showTOTPSettings(c *gin.Context) {
+	user, ok := fm.currentUser(c)
+	if !ok {
+		c.Redirect(http.StatusSeeOther, "/file/login")
+		return
+	}
+	data := totpSettingsPageData{
+		pageData:       fm.newPageData(c, user),
+		Enabled:        user.TOTPSecret != "",
+		RemainingCodes: len(user.RecoveryCodes),
+	}
+	if key, ok := totpErrorMessages[c.Query("error")]; ok {
+		data.Error = fm.t(c, key)
+	}
+
+	if !data.Enabled {
+		// 刷新页面时沿用尚未确认的密钥，避免已扫描的二维码失效
+		secret, err := c.Cookie(fm.totpEnrollCookie())
+		if err != nil || validateTOTPSecret(secret) != nil {
+			secret = GenerateTOTPSecret()
+		}
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     fm.totpEnrollCookie(),
+			Value:    secret,
+			Path:     "/file/settings/2fa",
+			MaxAge:   totpEnrollMaxAge,
+			HttpOnly: true,
+			Secure:   c.Request.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		data.Secret = secret
+		data.URI = totpURI(fm.totpIssuer(), user.Username, secret)
+		if data.QRCode, err = qrCodeDataURI(data.URI); err != nil {
+			fm.log.Errorf("生成二维码失败: %v", err)
+		}
+	}
+	fm.renderHTML(c, http.StatusOK, templateTOTPSettings, data)
+}
+
+// 从用户存储中读取最新的用户，按组映射的 LDAP、OIDC 用户没有本地记录，此时跳转到 unsupported
+func (fm *FileManager) storedUser(c *gin.Context, unsupported string) (User, bool) {
+	current, ok := fm.currentUser(c)
+	if !ok {
+		c.Redirect(http.StatusSeeOther, "/file/login")
+		return User{}, false
+	}
+	user, err := fm.userStore.Lookup(current.Username)
+	if err != nil || user.EncryptPassword == "" {
+		c.Redirect(http.StatusSeeOther, unsupported)
+		return User{}, false
+	}
+	return fm.resolveUser(user), true
+}
+
+// 保存用户并显示新的恢复码
+func (fm *FileManager) saveTOTPSettings(c *gin.Context, user User, event string, codes []string) {
+	if err := fm.userStore.Update(user); errors.Is(err, ErrUserReadOnly) {
+		c.Redirect(http.StatusSeeOther, "/file/settings/2fa?error="+totpErrorUnsupported)
+		return
+	} else if err != nil {
+		fm.log.Errorf("保存用户 %s 的两步验证设置失败: %v", user.Username, err)
+		c.Redirect(http.StatusSeeOther, "/file/settings/2fa?error="+totpErrorFailed)
+		return
+	}
+	fm.audit(c, event, "username", user.Username)
+	if codes == nil {
+		c.Redirect(http.StatusSeeOther, "/file/settings/2fa")
+		return
+	}
+	fm.renderHTML(c, http.StatusOK, templateTOTPSettings, totpSettingsPageData{
+		pageData:       fm.newPageData(c, user),
+		Enabled:        true,
+		RemainingCodes: len(codes),
+		RecoveryCodes:  codes,
+	})
+}
+
+// 输入验证器应用显示的验证码确认绑定
+func (fm *FileManager) handleTOTPEnable(c *gin.Context) {
+	user, ok := fm.storedUser(c, "/file/settings/2fa?error="+totpErrorUnsupported)
+	if !ok {
+		return
+	}
+	secret, err := c.Cookie(fm.totpEnrollCookie())
+	if err != nil || validateTOTPSecret(secret) != nil || user.TOTPSecret != "" {
+		c.Redirect(http.StatusSeeOther, "/file/settings/2fa")
+		return
+	}
+	if !fm.totpGuard.verify(user.Username, secret, strings.ReplaceAll(c.PostForm("code"), " ", "")) {
+		c.Redirect(http.StatusSeeOther, "/file/settings/2fa?error="+totpErrorCode)
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{Name: fm.totpEnrollCookie(), Path: "/file/settings/2fa", MaxAge: -1})
+	codes, hashes := generateRecoveryCodes()
+	user.TOTPSecret, user.RecoveryCodes = secret, hashes
+	fm.saveTOTPSettings(c, user, AuditTOTPEnabled, codes)
+}
+
+// 输入验证码或恢复码后关闭两步验证
+func (fm *FileManager) handleTOTPDisable(c *gin.Context) {
+	user, ok := fm.storedUser(c, "/file/settings/2fa?error="+totpErrorUnsupported)
+	if !ok {
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.Redirect(http.StatusSeeOther, "/file/settings/2fa")
+		return
+	}
+	if _, ok = fm.verifySecondFactor(user, c.PostForm("code")); !ok {
+		c.Redirect(http.StatusSeeOther, "/file/settings/2fa?error="+totpErrorCode)
+		return
+	}
+	// 使用恢复码时用户已被修改，重新读取后再保存
+	stored, err := fm.userStore.Lookup(user.Username)
+	if err != nil {
+		fm.log.Errorf("读取用户 %s 失败: %v", user.Username, err)
+		c.Redirect(http.StatusSeeOther, "/file/settings/2fa?error="+totpErrorFailed)
+		return
+	}
+	user = fm.resolveUser(stored)
+	user.TOTPSecret, user.RecoveryCodes = "", nil
+	fm.saveTOTPSettings(c, user, AuditTOTPDisabled, nil)
+}
+
+// 输入验证码后重新生成恢复码，旧的恢复码全部失效
+func (fm *FileManager) handleRecoveryCodes(c *gin.Context) {
+	user, ok := fm.storedUser(c, "/file/settings/2fa?error="+totpErrorUnsupported)
+	if !ok {
+		return
+	}
+	if user.TOTPSecret == "" || !fm.totpGuard.verify(user.Username, user.TOTPSecret, strings.ReplaceAll(c.PostForm("code"), " ", "")) {
+		c.Redirect(http.StatusSeeOther, "/file/settings/2fa?error="+totpErrorCode)
+		return
+	}
+	codes, hashes := generateRecoveryCodes()
+	user.RecoveryCodes = hashes
+	fm.saveTOTPSettings(c, user, AuditRecoveryCodesReset, codes)
+}
@@ -0,0 +1,69 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// plainUserStore 只暴露 UserStore 接口，不支持原子删除恢复码
+type plainUserStore struct {
+	UserStore
+}
+
+// 并发使用同一个恢复码时只有一个请求成功
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	codes, hashes := generateRecoveryCodes()
+	newStore := func(t *testing.T) *FileUserStore {
+		store, err := NewFileUserStore(filepath.Join(t.TempDir(), "users.yaml"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := User{Username: "alice", EncryptPassword: DefaultHashPassword("secret"), TOTPSecret: GenerateTOTPSecret(), RecoveryCodes: hashes}
+		if err = store.Create(user); err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+
+	tests := []struct {
+		name  string
+		store func(t *testing.T) UserStore
+	}{
+		{"atomic store", func(t *testing.T) UserStore { return newStore(t) }},
+		{"per-user lock", func(t *testing.T) UserStore { return plainUserStore{newStore(t)} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store(t)
+			fm := NewFileManager(t.TempDir(), zap.NewNop()).SetUserStore(store)
+			user, err := store.Lookup("alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			var accepted atomic.Int32
+			for range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if method, ok := fm.verifySecondFactor(user, codes[0]); ok && method == secondFactorRecoveryCode {
+						accepted.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			if got := accepted.Load(); got != 1 {
+				t.Errorf("recovery code accepted %d times, want 1", got)
+			}
+			if user, _ = store.Lookup("alice"); len(user.RecoveryCodes) != len(codes)-1 {
+				t.Errorf("%d recovery codes left, want %d", len(user.RecoveryCodes), len(codes)-1)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+)
+
+var (
+	ErrUserNotFound    = errors.New("用户不存在")
+	ErrUserExists      = errors.New("用户已存在")
+	ErrInvalidPassword = errors.New("密码错误")
+	ErrUserReadOnly    = errors.New("用户来自程序设置或配置文件，修改无法保存")
+)
+
+// UserStore 用户存储，实现需要并发安全
+type UserStore interface {
+	// Lookup 查找用户，不存在时返回 ErrUserNotFound
+	Lookup(username string) (User, error)
+	// List 按用户名排序列出所有用户
+	List() ([]User, error)
+	// Create 创建用户，EncryptPassword 为已加密的密码，用户已存在时返回 ErrUserExists
+	Create(user User) error
+	// Update 更新用户，不存在时返回 ErrUserNotFound
+	Update(user User) error
+	// Delete 删除用户，不存在时返回 ErrUserNotFound
+	Delete(username string) error
+	// VerifyPassword 校验密码，用户不存在时返回 ErrUserNotFound，密码错误时返回 ErrInvalidPassword
+	VerifyPassword(username, password string) (User, error)
+}
+
+// SetUserStore 设置用户存储，默认使用 SetUsers 和用户文件组成的清单，只有用户文件中的用户可以修改
+func (fm *FileManager) SetUserStore(store UserStore) *FileManager {
+	fm.userStore = store
+	return fm
+}
+
+// 按用户名查找当前用户，存储中不存在时查找 OIDC 按组映射出的用户，查询失败时记录日志并视为不存在
+func (fm *FileManager) lookupUser(username string) (User, bool) {
+	user, err := fm.userStore.Lookup(username)
+	if err == nil {
+		return fm.resolveUser(user), true
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		fm.log.Errorf("查询用户 %s 失败: %v", username, err)
+	}
+	return User{}, false
+}
+
+// 会话对应的用户，按组映射的 OIDC 用户没有本地记录，按会话中保存的组重新映射
+func (fm *FileManager) sessionUser(s session) (User, bool) {
+	if len(s.OIDCGroups) == 0 {
+		return fm.lookupUser(s.Username)
+	}
+	if fm.oidc == nil {
+		return User{}, false
+	}
+	user, ok := fm.oidc.mapGroups(s.Username, s.OIDCGroups)
+	if !ok {
+		return User{}, false
+	}
+	return fm.resolveUser(user), true
+}
+
+// 以常量时间校验密码，hashPassword 用于兼容无法识别格式的自定义哈希
+func verifyUserPassword(user User, password string, hashPassword func(string) string) error {
+	if !checkPassword(user.EncryptPassword, password, hashPassword) {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// 将 User 转换为可序列化的 UserConfig
+func newUserConfig(user User) UserConfig {
+	var permissions []string
+	for permission, granted := range user.Permissions {
+		if granted {
+			permissions = append(permissions, permission)
+		}
+	}
+	sort.Strings(permissions)
+	return UserConfig{
+		PasswordHash:     user.EncryptPassword,
+		Role:             user.Role,
+		Roles:            user.Roles,
+		Groups:           user.Groups,
+		Permissions:      permissions,
+		PathRestrictions: user.BaseRolePathRestrictions,
+		PathBlocking:     user.BaseRolePathBlocking,
+		IP:               user.IP,
+		AllowedIPs:       user.AllowedIPs,
+		Locale:           user.Locale,
+		TOTPSecret:       user.TOTPSecret,
+		RecoveryCodes:    user.RecoveryCodes,
+		APITokens:        user.APITokens,
+		ACL:              user.ACL,
+		Home:             user.Home,
+		OIDCSubject:      user.OIDCSubject,
+	}
+}
+
+// 以下为 userRegistry 对 UserStore 的实现。用户文件中的用户通过 FileUserStore 写回用户文件后重新加载，
+// SetUsers 和配置文件设置的用户没有可以写回的位置，修改时返回 ErrUserReadOnly
+
+func (ur *userRegistry) Lookup(username string) (User, error) {
+	user, ok := ur.get(username)
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (ur *userRegistry) List() ([]User, error) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+	users := make([]User, 0, len(ur.users))
+	for _, username := range slices.Sorted(maps.Keys(ur.users)) {
+		users = append(users, ur.users[username])
+	}
+	return users, nil
+}
+
+// 可以保存该用户修改的用户文件，新用户写入用户文件
+func (ur *userRegistry) writableStore(username string) (*FileUserStore, error) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+	if ur.file == nil {
+		return nil, ErrUserReadOnly
+	}
+	_, static := ur.staticUsers[username]
+	_, inFile := ur.fileUsers[username]
+	if static && !inFile {
+		return nil, ErrUserReadOnly
+	}
+	return ur.file, nil
+}
+
+// 在用户文件上执行修改，成功后用写入的内容更新用户清单
+func (ur *userRegistry) modifyFile(username string, fn func(store *FileUserStore) error) error {
+	store, err := ur.writableStore(username)
+	if err != nil {
+		return err
+	}
+	if err = fn(store); err != nil {
+		return err
+	}
+	uf, err := store.snapshot()
+	if err != nil {
+		return err
+	}
+	ur.setFile(uf)
+	return nil
+}
+
+func (ur *userRegistry) Create(user User) error {
+	if _, ok := ur.get(user.Username); ok {
+		return ErrUserExists
+	}
+	return ur.modifyFile(user.Username, func(store *FileUserStore) error { return store.Create(user) })
+}
+
+func (ur *userRegistry) Update(user User) error {
+	if _, ok := ur.get(user.Username); !ok {
+		return ErrUserNotFound
+	}
+	return ur.modifyFile(user.Username, func(store *FileUserStore) error { return store.Update(user) })
+}
+
+func (ur *userRegistry) Delete(username string) error {
+	if _, ok := ur.get(username); !ok {
+		return ErrUserNotFound
+	}
+	return ur.modifyFile(username, func(store *FileUserStore) error { return store.Delete(username) })
+}
+
+func (ur *userRegistry) consumeRecoveryCode(username, hash string) error {
+	if _, ok := ur.get(username); !ok {
+		return ErrUserNotFound
+	}
+	return ur.modifyFile(username, func(store *FileUserStore) error { return store.consumeRecoveryCode(username, hash) })
+}
+
+func (ur *userRegistry) VerifyPassword(username, password string) (User, error) {
+	user, err := ur.Lookup(username)
+	if err != nil {
+		return User{}, err
+	}
+	ur.mu.RLock()
+	hashPassword := ur.hashPassword
+	ur.mu.RUnlock()
+	if err = verifyUserPassword(user, password, hashPassword); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
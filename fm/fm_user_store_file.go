@@ -0,0 +1,247 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// FileUserStore 基于 JSON、YAML 或 TOML 文件的用户存储，格式同 UsersFile
+// 每次访问前检查文件是否被修改，多个实例共享同一个文件时可以看到彼此的修改；
+// 修改时持有 path.lock 上的文件锁并重新读取文件，不会覆盖其他实例同时写入的内容
+type FileUserStore struct {
+	path         string
+	hashPassword func(string) string
+
+	mu      sync.Mutex
+	data    UsersFile
+	modTime time.Time
+	size    int64
+}
+
+// NewFileUserStore 创建文件用户存储，文件不存在时在首次写入时创建，hashPassword 为空时使用 DefaultHashPassword
+func NewFileUserStore(path string, hashPassword func(string) string) (*FileUserStore, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json", ".toml":
+	default:
+		return nil, fmt.Errorf("不支持的用户文件格式: %s", path)
+	}
+	if hashPassword == nil {
+		hashPassword = DefaultHashPassword
+	}
+
+	store := &FileUserStore{
+		path:         path,
+		hashPassword: hashPassword,
+		data:         UsersFile{Users: map[string]UserConfig{}},
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := store.refresh(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// 文件修改时间或大小变化时重新读取，调用方需持有写锁
+func (store *FileUserStore) refresh() error {
+	info, err := os.Stat(store.path)
+	if os.IsNotExist(err) {
+		store.data = UsersFile{Users: map[string]UserConfig{}}
+		store.modTime, store.size = time.Time{}, 0
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(store.modTime) && info.Size() == store.size {
+		return nil
+	}
+
+	data, err := LoadUsersFile(store.path)
+	if err != nil {
+		return err
+	}
+	if data.Users == nil {
+		data.Users = map[string]UserConfig{}
+	}
+	store.data = *data
+	store.modTime, store.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// 写入临时文件后替换，避免其他实例读到写了一半的文件，成功后才替换内存中的数据，调用方需持有写锁
+func (store *FileUserStore) save(users UsersFile) error {
+	var (
+		data []byte
+		err  error
+	)
+	switch strings.ToLower(filepath.Ext(store.path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(users)
+	case ".toml":
+		data, err = toml.Marshal(users)
+	default:
+		data, err = json.MarshalIndent(users, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(store.path, data); err != nil {
+		return err
+	}
+
+	store.data = users
+	info, err := os.Stat(store.path)
+	if err != nil {
+		// 文件已写入，下次访问时重新读取
+		store.modTime, store.size = time.Time{}, 0
+		return nil
+	}
+	store.modTime, store.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// 先写入同目录下的临时文件再重命名，其他进程不会读到写了一半的文件，临时文件的权限为 0600
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// 在进程内的写锁和跨进程的文件锁内重新读取文件，修改副本并保存，保存失败时内存中的数据保持不变
+func (store *FileUserStore) modify(fn func(users map[string]UserConfig) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	unlock, err := lockFile(store.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// 修改时间的精度有限，持有文件锁后总是重新读取
+	store.modTime, store.size = time.Time{}, 0
+	if err = store.refresh(); err != nil {
+		return err
+	}
+	next := store.data
+	next.Users = maps.Clone(store.data.Users)
+	if err = fn(next.Users); err != nil {
+		return err
+	}
+	return store.save(next)
+}
+
+// 读取当前文件内容的副本
+func (store *FileUserStore) snapshot() (*UsersFile, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := store.refresh(); err != nil {
+		return nil, err
+	}
+	uf := store.data
+	uf.Users = maps.Clone(store.data.Users)
+	return &uf, nil
+}
+
+func (store *FileUserStore) Lookup(username string) (User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := store.refresh(); err != nil {
+		return User{}, err
+	}
+	user, ok := store.data.Users[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user.ToUser(username), nil
+}
+
+func (store *FileUserStore) List() ([]User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := store.refresh(); err != nil {
+		return nil, err
+	}
+	users := make([]User, 0, len(store.data.Users))
+	for _, username := range slices.Sorted(maps.Keys(store.data.Users)) {
+		users = append(users, store.data.Users[username].ToUser(username))
+	}
+	return users, nil
+}
+
+func (store *FileUserStore) Create(user User) error {
+	return store.modify(func(users map[string]UserConfig) error {
+		if _, ok := users[user.Username]; ok {
+			return ErrUserExists
+		}
+		users[user.Username] = newUserConfig(user)
+		return nil
+	})
+}
+
+func (store *FileUserStore) Update(user User) error {
+	return store.modify(func(users map[string]UserConfig) error {
+		if _, ok := users[user.Username]; !ok {
+			return ErrUserNotFound
+		}
+		users[user.Username] = newUserConfig(user)
+		return nil
+	})
+}
+
+func (store *FileUserStore) Delete(username string) error {
+	return store.modify(func(users map[string]UserConfig) error {
+		if _, ok := users[username]; !ok {
+			return ErrUserNotFound
+		}
+		delete(users, username)
+		return nil
+	})
+}
+
+// 在文件锁内检查并删除恢复码，多个实例共享文件时同一个恢复码也只能使用一次
+func (store *FileUserStore) consumeRecoveryCode(username, hash string) error {
+	return store.modify(func(users map[string]UserConfig) error {
+		user, ok := users[username]
+		if !ok {
+			return ErrUserNotFound
+		}
+		if user.RecoveryCodes, ok = removeRecoveryCode(user.RecoveryCodes, hash); !ok {
+			return errRecoveryCodeNotFound
+		}
+		users[username] = user
+		return nil
+	})
+}
+
+func (store *FileUserStore) VerifyPassword(username, password string) (User, error) {
+	user, err := store.Lookup(username)
+	if err != nil {
+		return User{}, err
+	}
+	if err = verifyUserPassword(user, password, store.hashPassword); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
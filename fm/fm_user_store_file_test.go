@@ -0,0 +1,120 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// 两个实例共享同一个文件并发写入，不会丢失对方的修改
+func TestFileUserStoreSharedWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	stores := make([]*FileUserStore, 2)
+	for i := range stores {
+		store, err := NewFileUserStore(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores[i] = store
+	}
+
+	hash := DefaultHashPassword("secret")
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				if err := store.Create(User{Username: fmt.Sprintf("user-%d-%d", i, j), EncryptPassword: hash}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	reader, err := NewFileUserStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := reader.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 40 {
+		t.Fatalf("got %d users, want 40", len(users))
+	}
+}
+
+// 修改函数返回错误时内存中的数据保持不变
+func TestFileUserStoreFailedModify(t *testing.T) {
+	store, err := NewFileUserStore(filepath.Join(t.TempDir(), "users.yaml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Create(User{Username: "alice", EncryptPassword: DefaultHashPassword("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	err = store.modify(func(users map[string]UserConfig) error {
+		delete(users, "alice")
+		return ErrUserNotFound
+	})
+	if err == nil {
+		t.Fatal("modify succeeded")
+	}
+	if _, err = store.Lookup("alice"); err != nil {
+		t.Fatalf("alice lost after failed modify: %v", err)
+	}
+}
+
+// 默认用户清单中用户文件的用户修改后写回文件，重新加载后仍然有效；程序设置的用户无法保存修改
+func TestUserRegistryPersistsFileUsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	data := "users:\n  alice:\n    password_hash: " + DefaultHashPassword("secret") + "\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fm := NewFileManager(t.TempDir(), zap.NewNop()).SetUsers(map[string]User{
+		"bob": {Username: "bob", EncryptPassword: DefaultHashPassword("secret")},
+	}).SetUsersFile(path)
+
+	alice, err := fm.userStore.Lookup("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.APITokens = []APIToken{{ID: "t1", Name: "ci", Hash: hashAPIToken(apiTokenPrefix + "secret")}}
+	if err = fm.userStore.Update(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err = fm.ReloadUsers(); err != nil {
+		t.Fatal(err)
+	}
+	if alice, err = fm.userStore.Lookup("alice"); err != nil || len(alice.APITokens) != 1 {
+		t.Fatalf("alice after reload = %+v, %v, want the saved token", alice, err)
+	}
+
+	alice.APITokens = nil
+	if err = fm.userStore.Update(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err = fm.ReloadUsers(); err != nil {
+		t.Fatal(err)
+	}
+	if alice, _ = fm.userStore.Lookup("alice"); len(alice.APITokens) != 0 {
+		t.Error("revoked token is back after reload")
+	}
+
+	bob, _ := fm.userStore.Lookup("bob")
+	if err = fm.userStore.Update(bob); !errors.Is(err, ErrUserReadOnly) {
+		t.Errorf("update static user err = %v, want ErrUserReadOnly", err)
+	}
+	if err = NewFileManager(t.TempDir(), zap.NewNop()).SetUsers(map[string]User{"bob": bob}).userStore.Update(bob); !errors.Is(err, ErrUserReadOnly) {
+		t.Errorf("update without users file err = %v, want ErrUserReadOnly", err)
+	}
+}
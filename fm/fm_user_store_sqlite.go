@@ -0,0 +1,294 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteUserSchema = `
+CREATE TABLE IF NOT EXISTS fm_users (
+	username          TEXT PRIMARY KEY,
+	password_hash     TEXT NOT NULL,
+	role              TEXT NOT NULL DEFAULT '',
+	permissions       TEXT NOT NULL DEFAULT '[]',
+	path_restrictions TEXT NOT NULL DEFAULT '[]',
+	path_blocking     TEXT NOT NULL DEFAULT '[]',
+	ip                TEXT NOT NULL DEFAULT '',
+	locale            TEXT NOT NULL DEFAULT '',
+	totp_secret       TEXT NOT NULL DEFAULT '',
+	recovery_codes    TEXT NOT NULL DEFAULT '[]',
+	api_tokens        TEXT NOT NULL DEFAULT '[]',
+	allowed_ips       TEXT NOT NULL DEFAULT '[]',
+	roles             TEXT NOT NULL DEFAULT '[]',
+	user_groups       TEXT NOT NULL DEFAULT '[]',
+	acl               TEXT NOT NULL DEFAULT '[]',
+	home              TEXT NOT NULL DEFAULT '',
+	oidc_subject      TEXT NOT NULL DEFAULT ''
+)`
+
+// 旧版本创建的表中缺少的列
+var sqliteUserMigrations = []struct {
+	column     string
+	definition string
+}{
+	{"totp_secret", "TEXT NOT NULL DEFAULT ''"},
+	{"recovery_codes", "TEXT NOT NULL DEFAULT '[]'"},
+	{"api_tokens", "TEXT NOT NULL DEFAULT '[]'"},
+	{"allowed_ips", "TEXT NOT NULL DEFAULT '[]'"},
+	{"roles", "TEXT NOT NULL DEFAULT '[]'"},
+	{"user_groups", "TEXT NOT NULL DEFAULT '[]'"},
+	{"acl", "TEXT NOT NULL DEFAULT '[]'"},
+	{"home", "TEXT NOT NULL DEFAULT ''"},
+	{"oidc_subject", "TEXT NOT NULL DEFAULT ''"},
+}
+
+const sqliteUserColumns = "username, password_hash, role, permissions, path_restrictions, path_blocking, ip, locale, totp_secret, recovery_codes, api_tokens, allowed_ips, roles, user_groups, acl, home, oidc_subject"
+
+// 按 sqliteUserColumns 生成的写入语句，参数顺序与 sqliteUserArgs 一致，UPDATE 的用户名作为最后一个参数
+var sqliteUserInsert, sqliteUserUpdate = func() (string, string) {
+	columns := strings.Split(sqliteUserColumns, ", ")
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	assignments := make([]string, 0, len(columns)-1)
+	for _, column := range columns[1:] {
+		assignments = append(assignments, column+" = ?")
+	}
+	return "INSERT INTO fm_users (" + sqliteUserColumns + ") VALUES (" + placeholders + ") ON CONFLICT(username) DO NOTHING",
+		"UPDATE fm_users SET " + strings.Join(assignments, ", ") + " WHERE username = ?"
+}()
+
+// SQLiteUserStore 基于嵌入式 SQLite 的用户存储，多个实例可以共享同一个数据库文件
+type SQLiteUserStore struct {
+	db           *sql.DB
+	hashPassword func(string) string
+}
+
+// NewSQLiteUserStore 打开或创建 SQLite 数据库，hashPassword 为空时使用 DefaultHashPassword
+func NewSQLiteUserStore(path string, hashPassword func(string) string) (*SQLiteUserStore, error) {
+	if hashPassword == nil {
+		hashPassword = DefaultHashPassword
+	}
+
+	// WAL 模式允许多个实例同时读，busy_timeout 避免并发写入时立即报错
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开用户数据库 %s 失败: %v", path, err)
+	}
+	if _, err = db.Exec(sqliteUserSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化用户数据库 %s 失败: %v", path, err)
+	}
+	if err = migrateSQLiteUsers(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("升级用户数据库 %s 失败: %v", path, err)
+	}
+	return &SQLiteUserStore{db: db, hashPassword: hashPassword}, nil
+}
+
+// 为旧版本创建的表补充新增的列
+func migrateSQLiteUsers(db *sql.DB) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info('fm_users')")
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, migration := range sqliteUserMigrations {
+		if existing[migration.column] {
+			continue
+		}
+		if _, err = db.Exec("ALTER TABLE fm_users ADD COLUMN " + migration.column + " " + migration.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 关闭数据库
+func (store *SQLiteUserStore) Close() error {
+	return store.db.Close()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSQLiteUser(row rowScanner) (User, error) {
+	var (
+		username                                  string
+		uc                                        UserConfig
+		permissions, pathRestrictions, pathBlocks string
+		recoveryCodes, apiTokens, allowedIPs      string
+		roles, groups, acl                        string
+	)
+	err := row.Scan(&username, &uc.PasswordHash, &uc.Role, &permissions, &pathRestrictions, &pathBlocks, &uc.IP, &uc.Locale,
+		&uc.TOTPSecret, &recoveryCodes, &apiTokens, &allowedIPs, &roles, &groups, &acl, &uc.Home, &uc.OIDCSubject)
+	if err != nil {
+		return User{}, err
+	}
+	columns := []struct {
+		data   string
+		target *[]string
+	}{
+		{permissions, &uc.Permissions},
+		{pathRestrictions, &uc.PathRestrictions},
+		{pathBlocks, &uc.PathBlocking},
+		{recoveryCodes, &uc.RecoveryCodes},
+		{allowedIPs, &uc.AllowedIPs},
+		{roles, &uc.Roles},
+		{groups, &uc.Groups},
+	}
+	for _, column := range columns {
+		if err = json.Unmarshal([]byte(column.data), column.target); err != nil {
+			return User{}, fmt.Errorf("用户 %s 的数据损坏: %v", username, err)
+		}
+	}
+	if err = json.Unmarshal([]byte(apiTokens), &uc.APITokens); err != nil {
+		return User{}, fmt.Errorf("用户 %s 的数据损坏: %v", username, err)
+	}
+	if err = json.Unmarshal([]byte(acl), &uc.ACL); err != nil {
+		return User{}, fmt.Errorf("用户 %s 的数据损坏: %v", username, err)
+	}
+	return uc.ToUser(username), nil
+}
+
+// 按列顺序生成参数，列表字段编码为 JSON 数组
+func sqliteUserArgs(user User) ([]any, error) {
+	uc := newUserConfig(user)
+	lists := make([]string, 0, 7)
+	for _, list := range [][]string{uc.Permissions, uc.PathRestrictions, uc.PathBlocking, uc.RecoveryCodes, uc.AllowedIPs, uc.Roles, uc.Groups} {
+		if list == nil {
+			list = []string{}
+		}
+		data, err := json.Marshal(list)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, string(data))
+	}
+	apiTokens := uc.APITokens
+	if apiTokens == nil {
+		apiTokens = []APIToken{}
+	}
+	tokens, err := json.Marshal(apiTokens)
+	if err != nil {
+		return nil, err
+	}
+	aclRules := uc.ACL
+	if aclRules == nil {
+		aclRules = []ACLRule{}
+	}
+	acl, err := json.Marshal(aclRules)
+	if err != nil {
+		return nil, err
+	}
+	return []any{user.Username, uc.PasswordHash, uc.Role, lists[0], lists[1], lists[2], uc.IP, uc.Locale, uc.TOTPSecret, lists[3], string(tokens), lists[4], lists[5], lists[6], string(acl), uc.Home, uc.OIDCSubject}, nil
+}
+
+func (store *SQLiteUserStore) Lookup(username string) (User, error) {
+	row := store.db.QueryRow("SELECT "+sqliteUserColumns+" FROM fm_users WHERE username = ?", username)
+	user, err := scanSQLiteUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (store *SQLiteUserStore) List() ([]User, error) {
+	rows, err := store.db.Query("SELECT " + sqliteUserColumns + " FROM fm_users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanSQLiteUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (store *SQLiteUserStore) Create(user User) error {
+	args, err := sqliteUserArgs(user)
+	if err != nil {
+		return err
+	}
+	result, err := store.db.Exec(sqliteUserInsert, args...)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrUserExists
+	}
+	return nil
+}
+
+func (store *SQLiteUserStore) Update(user User) error {
+	args, err := sqliteUserArgs(user)
+	if err != nil {
+		return err
+	}
+	// 用户名作为最后一个参数用于 WHERE 条件
+	args = append(args[1:], user.Username)
+	result, err := store.db.Exec(sqliteUserUpdate, args...)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+func (store *SQLiteUserStore) Delete(username string) error {
+	result, err := store.db.Exec("DELETE FROM fm_users WHERE username = ?", username)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+func (store *SQLiteUserStore) VerifyPassword(username, password string) (User, error) {
+	user, err := store.Lookup(username)
+	if err != nil {
+		return User{}, err
+	}
+	if err = verifyUserPassword(user, password, store.hashPassword); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// 没有行被修改时返回 ErrUserNotFound
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+// Package fm @author: Violet-Eva @date  : 2026/10/18 @notes :
+package fm
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 用户文件变化后等待该时长再重新加载，合并编辑器保存时产生的多次事件
+const usersReloadDebounce = 200 * time.Millisecond
+
+// UsersFile 用户文件，格式与 Config 中的 users、guest 字段相同
+type UsersFile struct {
+	Users map[string]UserConfig `json:"users"           yaml:"users"           toml:"users"`
+	Guest *UserConfig           `json:"guest,omitempty" yaml:"guest,omitempty" toml:"guest,omitempty"` // 为空时保留 SetGuestUser 设置的游客
+}
+
+// LoadUsersFile 读取并校验用户文件
+func LoadUsersFile(path string) (*UsersFile, error) {
+	var uf UsersFile
+	if err := decodeConfigFile(path, &uf); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for username, user := range uf.Users {
+		field := "users." + username
+		if err := validatePasswordHash(user.PasswordHash); err != nil {
+			errs = append(errs, fmt.Errorf("%s.password_hash: %v", field, err))
+		}
+		errs = append(errs, user.validate(field)...)
+	}
+	if uf.Guest != nil {
+		errs = append(errs, uf.Guest.validate("guest")...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("用户文件 %s 无效:\n%w", path, err)
+	}
+	return &uf, nil
+}
+
+// userRegistry 并发安全的用户清单，由 SetUsers 设置的用户和用户文件中的用户合并而成，同名时以用户文件为准
+type userRegistry struct {
+	mu           sync.RWMutex
+	hashPassword func(string) string
+	staticUsers  map[string]User
+	staticGuest  User
+	fileUsers    map[string]User
+	fileGuest    *User
+	file         *FileUserStore // 用户文件，修改用户文件中的用户时写回
+	users        map[string]User
+	guestUser    User
+}
+
+func newUserRegistry(guest User) *userRegistry {
+	return &userRegistry{
+		hashPassword: DefaultHashPassword,
+		staticUsers:  map[string]User{},
+		staticGuest:  guest,
+		users:        map[string]User{},
+		guestUser:    guest,
+	}
+}
+
+func (ur *userRegistry) setHashPassword(hashPassword func(string) string) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	ur.hashPassword = hashPassword
+}
+
+// 查找用户
+func (ur *userRegistry) get(username string) (User, bool) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+	user, ok := ur.users[username]
+	return user, ok
+}
+
+// 游客
+func (ur *userRegistry) guest() User {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+	return ur.guestUser
+}
+
+func (ur *userRegistry) setStatic(users map[string]User) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	ur.staticUsers = maps.Clone(users)
+	ur.rebuild()
+}
+
+func (ur *userRegistry) setStaticGuest(guest User) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	ur.staticGuest = guest
+	ur.rebuild()
+}
+
+func (ur *userRegistry) setFile(uf *UsersFile) {
+	users := make(map[string]User, len(uf.Users))
+	for username, user := range uf.Users {
+		users[username] = user.ToUser(username)
+	}
+	var guest *User
+	if uf.Guest != nil {
+		user := uf.Guest.ToUser("guest")
+		guest = &user
+	}
+
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	ur.fileUsers = users
+	ur.fileGuest = guest
+	ur.rebuild()
+}
+
+func (ur *userRegistry) setFileStore(store *FileUserStore) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+	ur.file = store
+}
+
+// 重新合并用户清单，调用方需持有写锁
+func (ur *userRegistry) rebuild() {
+	users := maps.Clone(ur.staticUsers)
+	if users == nil {
+		users = map[string]User{}
+	}
+	maps.Copy(users, ur.fileUsers)
+	ur.users = users
+
+	ur.guestUser = ur.staticGuest
+	if ur.fileGuest != nil {
+		ur.guestUser = *ur.fileGuest
+	}
+}
+
+// SetUsersFile 设置用户文件，启动后收到 SIGHUP 或文件变化时自动重新加载，已登录的会话立即使用新的用户和权限
+func (fm *FileManager) SetUsersFile(path string) *FileManager {
+	if err := fm.setUsersFile(path); err != nil {
+		fm.log.Error(err)
+	}
+	return fm
+}
+
+func (fm *FileManager) setUsersFile(path string) error {
+	uf, err := LoadUsersFile(path)
+	if err != nil {
+		return err
+	}
+	store, err := NewFileUserStore(path, nil)
+	if err != nil {
+		return err
+	}
+	fm.usersFile = path
+	fm.users.setFile(uf)
+	fm.users.setFileStore(store)
+	return nil
+}
+
+// ReloadUsers 重新加载用户文件，文件无效时保留当前用户清单
+func (fm *FileManager) ReloadUsers() error {
+	if fm.usersFile == "" {
+		return errors.New("未设置用户文件")
+	}
+	uf, err := LoadUsersFile(fm.usersFile)
+	if err != nil {
+		return err
+	}
+	fm.users.setFile(uf)
+	fm.resolveAllUsers()
+	fm.log.Infof("已重新加载用户文件 %s，共 %d 个用户", fm.usersFile, len(uf.Users))
+	return nil
+}
+
+// 监听 SIGHUP 和用户文件变化
+func (fm *FileManager) watchUsersFile() {
+	if fm.usersFile == "" {
+		return
+	}
+
+	reload := func() {
+		if err := fm.ReloadUsers(); err != nil {
+			fm.log.Errorf("重新加载用户失败: %v", err)
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reload()
+		}
+	}()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fm.log.Warnf("无法监听用户文件变化，仅支持 SIGHUP 重新加载: %v", err)
+		return
+	}
+	// 监听所在目录而不是文件本身，编辑器保存时通常会替换文件
+	if err = watcher.Add(filepath.Dir(fm.usersFile)); err != nil {
+		fm.log.Warnf("无法监听用户文件变化，仅支持 SIGHUP 重新加载: %v", err)
+		watcher.Close()
+		return
+	}
+
+	target := filepath.Clean(fm.usersFile)
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != target || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(usersReloadDebounce, reload)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fm.log.Warnf("监听用户文件出错: %v", err)
+			}
+		}
+	}()
+}
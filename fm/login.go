@@ -4,15 +4,39 @@ package fm
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// 登录错误码，用户不存在和密码错误使用同一个错误码，避免泄露用户名是否存在
+const (
+	loginErrorCredentials = "credentials"
+	loginErrorLocked      = "locked"
+	loginErrorFailed      = "failed"
+	loginErrorSSO         = "sso"
+	loginErrorIP          = "ip"
+)
+
+var loginErrorMessages = map[string]string{
+	loginErrorCredentials: "login.error.credentials",
+	loginErrorLocked:      "login.error.locked",
+	loginErrorFailed:      "login.error.failed",
+	loginErrorSSO:         "login.error.sso",
+	loginErrorIP:          "login.error.ip",
+}
+
+// 用户不存在时用于校验的哈希，使响应时间与密码错误时一致
+var dummyPasswordHash = sync.OnceValue(func() string {
+	return DefaultHashPassword(rand.Text())
+})
+
 // 登录菜单
 func (fm *FileManager) showLoginForm(c *gin.Context) {
 	if _, i := c.Get("user"); i {
@@ -20,51 +44,23 @@ func (fm *FileManager) showLoginForm(c *gin.Context) {
 		return
 	}
 
-	html := `
-	<!DOCTYPE html>
-	<html>
-	<head>
-		<meta charset="UTF-8">
-		<title>登录 - 文件管理器</title>
-		<style>
-			body { font-family: Arial, sans-serif; max-width: 400px; margin: 50px auto; padding: 20px; }
-			.login-form { border: 1px solid #ddd; padding: 20px; border-radius: 5px; }
-			.form-group { margin-bottom: 15px; }
-			label { display: block; margin-bottom: 5px; }
-			input[type="text"], input[type="password"] { width: 100%; padding: 8px; box-sizing: border-box; }
-			button { padding: 8px 15px; background-color: #4CAF50; color: white; border: none; border-radius: 3px; cursor: pointer; }
-			button:hover { background-color: #45a049; }
-			.error { color: red; margin-bottom: 15px; }
-			.guest-access { margin-top: 15px; padding-top: 15px; border-top: 1px solid #ddd; }
-		</style>
-	</head>
-	<body>
-		<div class="login-form">
-			<h2>文件管理器登录</h2>
-			<p>登录以获取更高权限，或直接访问以游客角色浏览</p>
-			` + c.Query("error") + `
-			<form method="post" action="/file/login">
-				<div class="form-group">
-					<label for="username">用户名:</label>
-					<input type="text" id="username" name="username" required>
-				</div>
-				<div class="form-group">
-					<label for="password">密码:</label>
-					<input type="password" id="password" name="password" required>
-				</div>
-				<div class="form-group">
-					<button type="submit">登录</button>
-				</div>
-			</form>
-			<div class="guest-access">
-				<a href="/file">以游客用户身份访问</a>
-			</div>
-		</div>
-	</body>
-	</html>
-	`
-
-	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+	// 禁用本地登录时直接跳转到 OIDC，登录失败时停留在登录页避免循环跳转
+	errorKey, hasError := loginErrorMessages[c.Query("error")]
+	if fm.oidc != nil && fm.oidc.config.DisableLocalLogin && !hasError {
+		c.Redirect(http.StatusSeeOther, "/file/login/oidc")
+		return
+	}
+
+	// error 参数只接受预定义的错误码，避免在页面中显示任意内容
+	data := loginPageData{
+		pageData:   fm.newPageData(c, fm.guest()),
+		LocalLogin: fm.oidc == nil || !fm.oidc.config.DisableLocalLogin,
+		SSO:        fm.oidc != nil,
+	}
+	if hasError {
+		data.Error = fm.t(c, errorKey)
+	}
+	fm.renderHTML(c, http.StatusOK, templateLogin, data)
 }
 
 // 创建默认JWT密钥
@@ -79,36 +75,62 @@ func generateRSAKeyPair() (*rsa.PrivateKey, *rsa.PublicKey, error) {
 }
 
 type JWTClaims struct {
-	Username string `json:"username"`
+	Username  string `json:"username"`
+	Purpose   string `json:"purpose,omitempty"` // 为空时为会话 token，其他用途的 token 不能用于访问
+	SessionID string `json:"sid,omitempty"`     // 会话 token 所属的会话，jti 为 RegisteredClaims.ID
+	Method    string `json:"method,omitempty"`  // 两步验证临时 token 中记录的第一步登录方式，如 password、oidc
 	jwt.RegisteredClaims
 }
 
-// 生成Token
-func (fm *FileManager) generateJWTToken(username string) (string, error) {
-	claims := JWTClaims{
-		username,
-		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Token 24小时后过期
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    fm.cookieName + "-jwt",
-		},
+// token 用途
+const (
+	tokenPurposeTOTP = "totp" // 密码校验通过、等待两步验证
+)
+
+// 生成会话的访问Token，有效期与访问 token cookie 一致
+func (fm *FileManager) generateJWTToken(s session) (string, error) {
+	ttl := time.Duration(fm.sessions.config.AccessTokenTTL)
+	jti := strings.ToLower(rand.Text())
+	token, err := fm.signJWTToken(JWTClaims{
+		Username:         s.Username,
+		SessionID:        s.ID,
+		RegisteredClaims: jwt.RegisteredClaims{ID: jti},
+	}, ttl)
+	if err != nil {
+		return "", err
+	}
+	if err = fm.sessions.setAccessToken(s.ID, jti, time.Now().Add(ttl)); err != nil {
+		fm.log.Warn(err)
 	}
+	return token, nil
+}
+
+func (fm *FileManager) signJWTToken(claims JWTClaims, ttl time.Duration) (string, error) {
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(ttl))
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.Issuer = fm.cookieName + "-jwt"
 
+	keys := fm.jwtKeys.current()
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(fm.privateKey)
+	token.Header["kid"] = keys.signingID
+	return token.SignedString(keys.signing)
 }
 
 // 验证Token
 func (fm *FileManager) validateJWTToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return fm.publicKey, nil
-	})
+	return fm.parseJWTToken(tokenString, "")
+}
+
+// 验证指定用途的Token
+func (fm *FileManager) parseJWTToken(tokenString, purpose string) (*JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, fm.jwtKeys.current().keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid && claims.Purpose == purpose {
 		return claims, nil
 	}
 
@@ -125,70 +147,211 @@ func (fm *FileManager) extractTokenFromRequest(c *gin.Context) string {
 		return authHeader
 	}
 
+	// API token 只接受 Authorization 请求头，避免出现在访问日志和浏览器历史中
 	token, err := c.Cookie(fm.cookieName)
-	if err == nil {
+	if err == nil && !strings.HasPrefix(token, apiTokenPrefix) {
 		return token
 	}
 
 	token = c.Query("token")
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		return ""
+	}
 	return token
 }
 
+func (fm *FileManager) refreshCookieName() string {
+	return fm.cookieName + "_refresh"
+}
+
 // 认证插件
 func (fm *FileManager) jwtAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := fm.extractTokenFromRequest(c)
-		if tokenString != "" {
-			claims, err := fm.validateJWTToken(tokenString)
-			if err != nil {
-				c.Set("user", fm.guestUser)
-			} else {
-				c.Set("user", fm.users[claims.Username])
+		_, refreshErr := c.Cookie(fm.refreshCookieName())
+		if tokenString != "" || refreshErr == nil {
+			// 每次请求都从用户清单中读取，重新加载后的权限对已登录会话立即生效，已删除的用户降级为游客
+			user := fm.guest()
+			if strings.HasPrefix(tokenString, apiTokenPrefix) {
+				if scoped, apiToken, err := fm.authenticateAPIToken(tokenString); err == nil {
+					user = scoped
+					c.Set("apiToken", apiToken.ID)
+				} else {
+					fm.audit(c, AuditAPITokenInvalid, "reason", err.Error())
+				}
+			} else if s, ok := fm.requestSession(c, tokenString); ok {
+				if current, exists := fm.sessionUser(s); exists {
+					user = current
+				}
 			}
+			if !fm.checkClientIP(c, user) {
+				c.Set("user", fm.guest())
+				fm.respondError(c, http.StatusForbidden, "error.ip_denied")
+				c.Abort()
+				return
+			}
+			c.Set("user", user)
 		}
 		c.Next()
 	}
 }
 
+// 校验访问 token 及其会话，访问 token 过期或缺失时用刷新 cookie 续期
+func (fm *FileManager) requestSession(c *gin.Context, tokenString string) (session, bool) {
+	if claims, err := fm.validateJWTToken(tokenString); err == nil {
+		if s, ok := fm.sessions.active(claims.SessionID, claims.ID); ok {
+			c.Set("sessionID", s.ID)
+			return s, true
+		}
+	}
+
+	refresh, err := c.Cookie(fm.refreshCookieName())
+	if err != nil {
+		return session{}, false
+	}
+	s, newRefresh, err := fm.sessions.refresh(refresh)
+	switch {
+	case errors.Is(err, ErrRefreshReused):
+		fm.audit(c, AuditSessionRefreshReused, "username", s.Username, "session_id", s.ID)
+		fm.clearSessionCookies(c)
+		return session{}, false
+	case errors.Is(err, ErrSessionNotFound):
+		fm.clearSessionCookies(c)
+		return session{}, false
+	case err != nil:
+		fm.log.Warn(err)
+	}
+	if err = fm.setSessionCookies(c, s, newRefresh); err != nil {
+		fm.log.Warn("生成JWT token失败,报错: ", err)
+		return session{}, false
+	}
+	c.Set("sessionID", s.ID)
+	return s, true
+}
+
+// 创建会话，生成访问 token 和刷新 token 并写入cookie
+func (fm *FileManager) issueSession(c *gin.Context, username string, oidcGroups []string) error {
+	s, refresh, err := fm.sessions.create(username, c.ClientIP(), c.Request.UserAgent(), oidcGroups)
+	if err != nil {
+		fm.log.Warn(err)
+	}
+	// 首次登录时创建家目录
+	if user, ok := fm.sessionUser(s); ok {
+		if _, homeErr := fm.filesFor(user); homeErr != nil {
+			fm.log.Warnf("创建用户 %s 的家目录失败: %v", username, homeErr)
+		}
+	}
+	return fm.setSessionCookies(c, s, refresh)
+}
+
+// 写入访问 token cookie，refresh 不为空时同时写入刷新 token cookie
+func (fm *FileManager) setSessionCookies(c *gin.Context, s session, refresh string) error {
+	token, err := fm.generateJWTToken(s)
+	if err != nil {
+		return err
+	}
+
+	// 跨站的 POST 等请求不携带会话 cookie，从其他站点的链接进入时仍然保持登录
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(
+		fm.cookieName, // cookie名称
+		token,         // token值
+		int(time.Duration(fm.sessions.config.AccessTokenTTL).Seconds()), // 过期时间（秒），与token有效期一致
+		"/",   // 路径
+		"",    // 域名
+		false, // 是否仅HTTPS
+		true,  // 是否仅HTTP（防止XSS攻击）
+	)
+	// 同一请求内后续读取cookie时可以拿到新token
+	c.Request.AddCookie(&http.Cookie{Name: fm.cookieName, Value: token})
+
+	if refresh != "" {
+		c.SetCookie(fm.refreshCookieName(), refresh, int(time.Until(s.ExpiresAt).Seconds()), "/file", "", false, true)
+		c.Request.AddCookie(&http.Cookie{Name: fm.refreshCookieName(), Value: refresh})
+	}
+	return nil
+}
+
+// 清除访问 token 和刷新 token cookie
+func (fm *FileManager) clearSessionCookies(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(fm.cookieName, "", -1, "/", "", false, true)
+	c.SetCookie(fm.refreshCookieName(), "", -1, "/file", "", false, true)
+}
+
 // 登录
 func (fm *FileManager) handleLogin(c *gin.Context) {
+	if fm.oidc != nil && fm.oidc.config.DisableLocalLogin {
+		fm.respondError(c, http.StatusForbidden, "login.error.local_disabled")
+		return
+	}
+
 	username := c.PostForm("username")
 	password := c.PostForm("password")
+	clientIP := c.ClientIP()
+
+	if wait, ok := fm.loginLimiter.allow(clientIP, username); !ok {
+		fm.audit(c, AuditLoginBlocked, "username", username, "retry_after", wait.Round(time.Second).String())
+		setRetryAfter(c, wait)
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorLocked)
+		return
+	}
 
-	user, exists := fm.users[username]
-	if !exists {
-		c.Redirect(http.StatusSeeOther, "/file/login?error=<p class='error'>账户不存在或账户名输入错误</p>")
+	user, err := fm.userStore.VerifyPassword(username, password)
+	switch {
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrInvalidPassword):
+		if errors.Is(err, ErrUserNotFound) {
+			checkPassword(dummyPasswordHash(), password, nil)
+		}
+		fm.audit(c, AuditLoginFailure, "username", username, "reason", err.Error())
+		if fm.loginLimiter.fail(clientIP, username) {
+			fm.audit(c, AuditLoginLocked, "username", username)
+		}
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorCredentials)
 		return
-	} else if user.EncryptPassword != fm.hashPassword(password) {
-		c.Redirect(http.StatusSeeOther, "/file/login?error=<p class='error'>密码输入错误</p>")
+	case err != nil:
+		fm.log.Errorf("校验用户 %s 失败: %v", username, err)
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorFailed)
 		return
 	}
 
-	token, err := fm.generateJWTToken(username)
-	if err != nil {
-		fm.log.Warn("生成JWT token失败,报错: ", err)
-		c.Redirect(http.StatusSeeOther, "/file/login?error=<p class='error'>登录失败，请重试</p>")
+	// 密码正确后再检查 IP，避免泄露用户是否存在
+	if !fm.checkClientIP(c, user) {
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorIP)
 		return
 	}
 
-	c.SetCookie(
-		fm.cookieName, // cookie名称
-		token,         // token值
-		fm.maxAge,     // 过期时间（秒）
-		"/",           // 路径
-		"",            // 域名
-		false,         // 是否仅HTTPS
-		true,          // 是否仅HTTP（防止XSS攻击）
-	)
+	fm.rehashPassword(user, password)
+
+	// 启用两步验证的用户需要先输入验证码才能拿到会话 token
+	if user.TOTPSecret != "" {
+		fm.startTOTPLogin(c, username, "password")
+		return
+	}
+
+	fm.loginLimiter.succeed(username)
+	if err = fm.issueSession(c, username, nil); err != nil {
+		fm.log.Warn("生成JWT token失败,报错: ", err)
+		c.Redirect(http.StatusSeeOther, "/file/login?error="+loginErrorFailed)
+		return
+	}
 
 	c.Set("user", user)
-	fm.log.Infof("%s login success with JWT token", username)
+	fm.audit(c, AuditLoginSuccess, "username", username, "method", "password")
+	fm.respondLogin(c, username)
+}
 
+// 登录成功，JSON请求返回token，浏览器请求跳转到文件列表
+func (fm *FileManager) respondLogin(c *gin.Context, username string) {
 	if c.GetHeader("Content-Type") == "application/json" {
+		token, _ := c.Cookie(fm.cookieName)
+		refresh, _ := c.Cookie(fm.refreshCookieName())
 		c.JSON(http.StatusOK, gin.H{
-			"token":    token,
-			"username": username,
-			"message":  "登录成功",
+			"token":         token,
+			"refresh_token": refresh,
+			"expires_in":    int(time.Duration(fm.sessions.config.AccessTokenTTL).Seconds()),
+			"username":      username,
+			"message":       fm.t(c, "login.success"),
 		})
 		return
 	}
@@ -197,33 +360,32 @@ func (fm *FileManager) handleLogin(c *gin.Context) {
 }
 
 func (fm *FileManager) handleLogout(c *gin.Context) {
-	// 从请求中获取当前token
+	// 撤销当前会话，已签发的访问 token 和刷新 token 立即失效，访问 token 已过期时通过刷新 token 找到会话
 	tokenString := fm.extractTokenFromRequest(c)
-
-	if tokenString != "" {
-		// 解析token获取用户信息用于日志记录
-		claims, err := fm.validateJWTToken(tokenString)
-		if err == nil {
-			fm.log.Infof("%s logout success", claims.Username)
+	var (
+		s   session
+		err error
+	)
+	if claims, parseErr := fm.validateJWTToken(tokenString); parseErr == nil {
+		s, err = fm.sessions.revoke(claims.SessionID, claims.ID, claims.ExpiresAt.Time)
+	} else if refresh, cookieErr := c.Cookie(fm.refreshCookieName()); cookieErr == nil {
+		if found, ok := fm.sessions.find(refresh); ok {
+			s, err = fm.sessions.revoke(found.ID, "", time.Time{})
 		}
 	}
-
-	// 清除cookie中的JWT token
-	c.SetCookie(
-		fm.cookieName, // cookie名称
-		"",            // 空值
-		-1,            // 过期时间，-1表示删除cookie
-		"/",           // 路径
-		"",            // 域名
-		false,         // 是否仅HTTPS
-		true,          // 是否仅HTTP
-	)
+	if s.ID != "" {
+		fm.audit(c, AuditLogout, "username", s.Username, "session_id", s.ID)
+	}
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		fm.log.Warn(err)
+	}
+	fm.clearSessionCookies(c)
 
 	if c.GetHeader("Content-Type") == "application/json" {
-		c.JSON(http.StatusOK, gin.H{"message": "登出成功"})
+		c.JSON(http.StatusOK, gin.H{"message": fm.t(c, "logout.success")})
 		return
 	}
 
-	c.Set("user", fm.guestUser)
+	c.Set("user", fm.guest())
 	c.Redirect(http.StatusSeeOther, "/file")
 }
@@ -4,8 +4,7 @@ package fm
 import (
 	"fmt"
 	"net/http"
-	"regexp"
-	"strings"
+	"slices"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,14 +23,51 @@ const (
 	PermissionDirRename    = "dir:rename"    // 重命名目录
 )
 
+// AllPermissions 所有权限
+var AllPermissions = []string{
+	PermissionFileView,
+	PermissionFileDownload,
+	PermissionFileEdit,
+	PermissionFileDelete,
+	PermissionFileRename,
+	PermissionDirView,
+	PermissionDirCreate,
+	PermissionDirUpload,
+	PermissionDirDelete,
+	PermissionDirRename,
+}
+
+// IsValidPermission 判断是否为已定义的权限
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
 	Username                 string
 	EncryptPassword          string
-	Role                     string
+	Role                     string   // 单个角色，兼容旧配置，与 Roles 合并
+	Roles                    []string // 命名角色，见 RoleConfig，内置角色 admin 拥有所有权限
+	Groups                   []string // 所在的组，组内的角色同样生效
 	Permissions              map[string]bool
 	BaseRolePathRestrictions []string
 	BaseRolePathBlocking     []string
-	IP                       string
+	IP                       string   // 允许访问的单个 IP 或 CIDR，与 AllowedIPs 合并
+	AllowedIPs               []string // 允许访问的 IP 或 CIDR，登录和每次请求时检查，为空时不限制
+	Locale                   string   // 界面语言，如 zh-CN、en-US，为空时按浏览器语言选择
+	TOTPSecret               string   // 两步验证密钥(base32)，为空时未启用
+	RecoveryCodes            []string // 两步验证恢复码的 SHA-256，每个只能使用一次
+	APITokens                []APIToken
+	TokenPathRestrictions    []string  // 通过 API token 访问时 token 限定的路径，非空时路径还需匹配其中之一
+	ACL                      []ACLRule // 按路径授予或拒绝的权限，见 ACLRule
+	Home                     string    // 家目录，相对根目录，优先于 home_dir，/ 表示不限制
+	OIDCSubject              string    // 绑定的 OIDC 账户(ID token 的 sub)，为空时不能通过 OIDC 登录
+
+	resolved *effectivePermissions // 解析角色和组后的权限，见 roleRegistry.resolve
 }
 
 func (u *User) String() string {
@@ -39,110 +75,143 @@ func (u *User) String() string {
 }
 
 func (u *User) IsAdmin() bool {
-	if u.Role == "admin" {
-		return true
-	} else {
-		return false
-	}
+	return u.effective().admin
 }
 
-func (u *User) HasPermission(permission string) bool {
-	if u.IsAdmin() {
-		return true
-	}
-	return u.Permissions[permission]
+// GroupMapping LDAP、OIDC 等外部身份源的组到角色和权限的映射，用户属于多个组时权限和路径取并集
+type GroupMapping struct {
+	Group            string   `json:"group"                       yaml:"group"                       toml:"group"`
+	Role             string   `json:"role,omitempty"              yaml:"role,omitempty"              toml:"role,omitempty"`
+	Permissions      []string `json:"permissions,omitempty"       yaml:"permissions,omitempty"       toml:"permissions,omitempty"`
+	PathRestrictions []string `json:"path_restrictions,omitempty" yaml:"path_restrictions,omitempty" toml:"path_restrictions,omitempty"`
+	PathBlocking     []string `json:"path_blocking,omitempty"     yaml:"path_blocking,omitempty"     toml:"path_blocking,omitempty"`
 }
 
-// isPathBlocked 检查路径是否被屏蔽
-func (u *User) isPathBlocked(path string) bool {
-	if u.IsAdmin() || len(u.BaseRolePathBlocking) == 0 {
-		return false
+// 校验组映射
+func validateGroupMappings(field string, mappings []GroupMapping) []error {
+	var errs []error
+	if len(mappings) == 0 {
+		errs = append(errs, fmt.Errorf("%s: 至少需要一个组映射", field))
 	}
-	for _, pattern := range u.BaseRolePathBlocking {
-		if matchPathBlockPattern(pattern, path) {
-			return true
+	for i, mapping := range mappings {
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		if mapping.Group == "" {
+			errs = append(errs, fmt.Errorf("%s.group: 不能为空", itemField))
 		}
+		uc := UserConfig{Permissions: mapping.Permissions, PathRestrictions: mapping.PathRestrictions, PathBlocking: mapping.PathBlocking}
+		errs = append(errs, uc.validate(itemField)...)
 	}
-
-	return false
+	return errs
 }
 
-// 检查路径是否匹配
-func matchPathBlockPattern(pattern, path string) bool {
-	if pattern == "/" && path == "/" {
-		return true
+// 按组映射生成用户，未映射到任何组时返回 false
+func mapGroups(username string, groups []string, mappings []GroupMapping, matches func(mapping, group string) bool) (User, bool) {
+	user := User{
+		Username:    username,
+		Permissions: map[string]bool{},
+	}
+	matched := false
+	for _, mapping := range mappings {
+		if !slices.ContainsFunc(groups, func(group string) bool { return matches(mapping.Group, group) }) {
+			continue
+		}
+		matched = true
+		// 组映射的角色可以是内置的 admin 或 roles 中定义的角色
+		if mapping.Role != "" {
+			user.Roles = appendUnique(user.Roles, mapping.Role)
+		}
+		for _, permission := range mapping.Permissions {
+			user.Permissions[permission] = true
+		}
+		user.BaseRolePathRestrictions = appendUnique(user.BaseRolePathRestrictions, mapping.PathRestrictions...)
+		user.BaseRolePathBlocking = appendUnique(user.BaseRolePathBlocking, mapping.PathBlocking...)
 	}
+	return user, matched
+}
 
-	normalizedPattern := "/" + strings.Trim(pattern, "/")
-	normalizedPath := "/" + strings.Trim(path, "/")
-	if normalizedPattern == normalizedPath {
-		return true
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if !slices.Contains(list, item) {
+			list = append(list, item)
+		}
 	}
+	return list
+}
 
-	regexpStr := fmt.Sprintf("^%s", normalizedPattern)
-	compile := regexp.MustCompile(regexpStr)
-	return compile.MatchString(normalizedPath)
+// HasPermission 按用户自身、角色和所在组合并后的全局权限判断，不考虑路径规则，针对具体路径时使用 Can
+func (u *User) HasPermission(permission string) bool {
+	return u.effective().has(permission)
 }
 
-// IsPathAllowed 检查路径是否可以访问
+// isPathBlocked 检查相对根目录的路径是否被屏蔽，屏蔽规则无效时按屏蔽处理
+func (u *User) isPathBlocked(path string) bool {
+	effective := u.effective()
+	if effective.admin {
+		return false
+	}
+	return effective.err != nil || effective.blocking.matches(path)
+}
+
+// IsPathAllowed 检查路径是否可以访问，可访问路径的上级目录同样可以访问，以便逐级进入。
+// 路径相对用户可见的根目录，有家目录时先转换为相对根目录的路径再匹配 path_restrictions 和 path_blocking，
+// API token 限定的路径由用户在自己的视图中填写，仍按相对家目录匹配
 func (u *User) IsPathAllowed(path string) bool {
-	if u.IsAdmin() {
+	effective := u.effective()
+	if effective.admin {
 		return true
 	}
 
-	if u.isPathBlocked(path) {
+	if u.isPathBlocked(effective.absPath(path)) {
 		return false
 	}
 
-	for _, pattern := range u.BaseRolePathRestrictions {
-		if matchPathPattern(pattern, path) {
-			return true
-		}
+	if len(effective.tokenRestrictions) > 0 && !effective.tokenRestrictions.reaches(path) {
+		return false
 	}
-	return false
-}
 
-// 检查路径是否匹配
-func matchPathPattern(pattern, path string) bool {
-	if pattern == "/" && path == "/" {
-		return true
-	}
+	return effective.restrictions.reaches(effective.absPath(path))
+}
 
-	normalizedPattern := "/" + strings.Trim(pattern, "/")
-	normalizedPath := "/" + strings.Trim(path, "/")
-	if normalizedPattern == normalizedPath {
-		return true
+// 权限中间件
+// 只允许通过会话登录的管理员访问
+func (fm *FileManager) requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := fm.currentUser(c)
+		if !ok || !user.IsAdmin() {
+			fm.respondError(c, http.StatusForbidden, "perm.denied")
+			c.Abort()
+			return
+		}
+		c.Next()
 	}
-
-	regexpStr := fmt.Sprintf("^%s", normalizedPattern)
-	compile := regexp.MustCompile(regexpStr)
-	return compile.MatchString(normalizedPath) || strings.HasPrefix(normalizedPattern, normalizedPath)
 }
 
-// 权限中间件
 func (fm *FileManager) requirePermission(requiredPermission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tmpUser, isExist := c.Get("user")
 		var user User
 		if !isExist {
-			user = fm.guestUser
+			user = fm.guest()
 		} else {
 			var exists bool
 			user, exists = tmpUser.(User)
 			if !exists {
-				user = fm.guestUser
+				user = fm.guest()
 			}
 		}
 		c.Set("user", user)
-		if !user.HasPermission(requiredPermission) {
-			c.String(http.StatusForbidden, "权限不足，无法访问此功能")
+		if !fm.resolveRequestPath(c, user) {
+			return
+		}
+		path := requestPath(c)
+		if !user.Can(requiredPermission, path) {
+			fm.respondError(c, http.StatusForbidden, "perm.denied")
 			c.Abort()
 			return
 		}
 
-		path := c.Query("path")
 		if !user.IsPathAllowed(path) {
-			c.String(http.StatusForbidden, "没有权限访问此路径")
+			fm.respondError(c, http.StatusForbidden, "perm.path_denied")
 			c.Abort()
 			return
 		}
@@ -156,18 +225,16 @@ func (fm *FileManager) checkPathPermission() gin.HandlerFunc {
 		user, exists := c.Get("user")
 		if !exists {
 			// 如果没有用户信息，赋予user角色
-			user = fm.guestUser
+			user = fm.guest()
 			c.Set("user", user)
 		}
 		currentUser := user.(User)
 
-		path := c.PostForm("path")
-		if path == "" {
-			path = c.Query("path")
+		if !fm.resolveRequestPath(c, currentUser) {
+			return
 		}
-
-		if !currentUser.IsPathAllowed(path) {
-			c.String(http.StatusForbidden, "没有权限访问此路径")
+		if !currentUser.IsPathAllowed(requestPath(c)) {
+			fm.respondError(c, http.StatusForbidden, "perm.path_denied")
 			c.Abort()
 			return
 		}